@@ -0,0 +1,324 @@
+package cart
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
+)
+
+// Abandoned cart statuses. An open cart is still being reminded about; the
+// others say how it ended.
+const (
+	AbandonedOpen      = "open"
+	AbandonedRecovered = "recovered"
+	AbandonedConverted = "converted"
+	AbandonedEmptied   = "emptied"
+	AbandonedExpired   = "expired"
+)
+
+// sweepBatchSize is how many carts the sweep loads at a time.
+const sweepBatchSize = 100
+
+// owner identifies a cart: a user, or a guest when userID is 0.
+type owner struct {
+	userID  uint
+	guestID string
+}
+
+func (o owner) scope(db *gorm.DB) *gorm.DB {
+	if o.userID != 0 {
+		return db.Where("user_id = ?", o.userID)
+	}
+	return db.Where("user_id = 0 AND guest_id = ?", o.guestID)
+}
+
+func lastActivity(items []models.Cart) time.Time {
+	var last time.Time
+	for _, item := range items {
+		if item.UpdatedAt.After(last) {
+			last = item.UpdatedAt
+		}
+	}
+	return last
+}
+
+// SweepAbandoned finds carts nobody has touched for ABANDONED_CART_AFTER,
+// reminds their owners up to ABANDONED_CART_MAX_REMINDERS times and empties
+// carts older than CART_EXPIRY. Abandoned carts whose owner came back,
+// ordered or emptied the cart are closed. Guests cannot be reminded, but
+// their carts are tracked and expired the same way.
+func SweepAbandoned(db *gorm.DB, notifier notify.Notifier) error {
+	now := time.Now()
+
+	if err := closeAbandoned(db, now); err != nil {
+		return err
+	}
+
+	reminded, expired := 0, 0
+	var after *owner
+	for {
+		keys, err := staleOwners(db, now.Add(-abandonAfter), after)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			r, e, err := sweepCart(db, notifier, key, now)
+			if err != nil {
+				return err
+			}
+			reminded += r
+			expired += e
+		}
+		if len(keys) < sweepBatchSize {
+			break
+		}
+		after = &keys[len(keys)-1]
+	}
+
+	if reminded > 0 || expired > 0 {
+		log.Printf("Sent %d abandoned cart reminders and expired %d carts", reminded, expired)
+	}
+	return nil
+}
+
+// ownerGuestID is the guest part of a cart's owner, matching owner.scope:
+// a user's lines belong to one cart whatever guest they were added as.
+const ownerGuestID = "CASE WHEN user_id = 0 THEN COALESCE(guest_id, '') ELSE '' END"
+
+// staleOwners returns the next batch of carts, ordered after the given one,
+// that nobody has changed since cutoff.
+func staleOwners(db *gorm.DB, cutoff time.Time, after *owner) ([]owner, error) {
+	query := db.Model(&models.Cart{}).
+		Select("user_id, "+ownerGuestID+" AS guest_id").
+		Group("user_id, "+ownerGuestID).
+		Having("MAX(updated_at) <= ?", cutoff)
+	if after != nil {
+		query = query.Where("user_id > ? OR (user_id = ? AND "+ownerGuestID+" > ?)",
+			after.userID, after.userID, after.guestID)
+	}
+
+	var rows []struct {
+		UserID  uint
+		GuestID string
+	}
+	if err := query.Order("user_id, guest_id").Limit(sweepBatchSize).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	keys := make([]owner, len(rows))
+	for i, row := range rows {
+		keys[i] = owner{userID: row.UserID, guestID: row.GuestID}
+	}
+	return keys, nil
+}
+
+// sweepCart flags, reminds or expires one cart and reports how many
+// reminders it sent and carts it expired.
+func sweepCart(db *gorm.DB, notifier notify.Notifier, key owner, now time.Time) (reminded, expired int, err error) {
+	lines, err := Load(key.scope(db.Model(&models.Cart{})))
+	if err != nil || len(lines) == 0 {
+		return 0, 0, err
+	}
+	last := lastActivity(lines)
+	if now.Sub(last) < abandonAfter {
+		return 0, 0, nil
+	}
+
+	expire := expireAfter > 0 && now.Sub(last) >= expireAfter
+
+	// A cart already settled, like one left behind after an order, is not
+	// flagged again, only expired.
+	var record models.AbandonedCart
+	if err := key.scope(db).Order("id desc").Limit(1).Find(&record).Error; err != nil {
+		return 0, 0, err
+	}
+	if record.ID != 0 && !last.After(record.LastActivityAt) && record.Status != AbandonedOpen {
+		if !expire {
+			return 0, 0, nil
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return empty(tx, key)
+		}); err != nil {
+			return 0, 0, err
+		}
+		return 0, 1, nil
+	}
+	if record.ID == 0 || last.After(record.LastActivityAt) {
+		record = models.AbandonedCart{
+			UserID:         key.userID,
+			GuestID:        key.guestID,
+			LastActivityAt: last,
+			Status:         AbandonedOpen,
+		}
+	}
+
+	_, summary := Summarize(db, lines, key.userID)
+	record.Items = summary.Items
+	record.Value = summary.Total
+
+	if expire {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := empty(tx, key); err != nil {
+				return err
+			}
+			record.Status = AbandonedExpired
+			record.ClosedAt = &now
+			return tx.Save(&record).Error
+		}); err != nil {
+			return 0, 0, err
+		}
+		return 0, 1, nil
+	}
+
+	due := record.LastRemindedAt == nil || now.Sub(*record.LastRemindedAt) >= abandonAfter
+	if key.userID != 0 && summary.Items > 0 && record.RemindersSent < maxReminders && due {
+		if sendReminder(db, notifier, key.userID, lines) {
+			record.RemindersSent++
+			record.LastRemindedAt = &now
+			reminded = 1
+		}
+	}
+	return reminded, 0, db.Save(&record).Error
+}
+
+// empty removes every line of a cart and the stock it holds.
+func empty(tx *gorm.DB, key owner) error {
+	if err := key.scope(tx).Delete(&models.Cart{}).Error; err != nil {
+		return err
+	}
+	if key.userID == 0 {
+		return nil
+	}
+	return inventory.ReleaseAll(tx, key.userID)
+}
+
+// closeAbandoned settles open abandoned carts: converted if the user has
+// ordered since it was flagged, emptied if the cart is gone, and recovered
+// if the cart was changed again.
+func closeAbandoned(db *gorm.DB, now time.Time) error {
+	var open []models.AbandonedCart
+	return db.Where("status = ?", AbandonedOpen).FindInBatches(&open, sweepBatchSize, func(_ *gorm.DB, _ int) error {
+		for i := range open {
+			record := &open[i]
+			key := owner{userID: record.UserID, guestID: record.GuestID}
+
+			var lines []models.Cart
+			if err := key.scope(db).Select("id", "updated_at").Find(&lines).Error; err != nil {
+				return err
+			}
+
+			status := ""
+			var ordered int64
+			if record.UserID != 0 {
+				if err := db.Model(&models.Order{}).
+					Where("user_id = ? AND created_at > ?", record.UserID, record.CreatedAt).
+					Count(&ordered).Error; err != nil {
+					return err
+				}
+			}
+			switch {
+			case ordered > 0:
+				status = AbandonedConverted
+			case len(lines) == 0:
+				status = AbandonedEmptied
+			case lastActivity(lines).After(record.LastActivityAt):
+				status = AbandonedRecovered
+			default:
+				continue
+			}
+
+			if err := db.Model(record).Updates(map[string]interface{}{
+				"status":    status,
+				"closed_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func sendReminder(db *gorm.DB, notifier notify.Notifier, userID uint, lines []models.Cart) bool {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return false
+	}
+
+	var names []string
+	for _, line := range lines {
+		if line.Product.ID != 0 && !line.Product.DeletedAt.Valid {
+			names = append(names, fmt.Sprintf("%d x %s", line.Quantity, line.Product.Name))
+		}
+	}
+	if len(names) == 0 {
+		return false
+	}
+
+	notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "You left something in your cart",
+		Body: fmt.Sprintf("Your cart is waiting for you: %s. Pick up where you left off at %s/cart.",
+			strings.Join(names, ", "), appURL),
+	})
+	return true
+}
+
+// Stats summarises abandoned carts flagged since a point in time.
+type Stats struct {
+	Open          int64   `json:"open"`
+	Recovered     int64   `json:"recovered"`
+	Converted     int64   `json:"converted"`
+	Emptied       int64   `json:"emptied"`
+	Expired       int64   `json:"expired"`
+	RemindersSent int64   `json:"reminders_sent"`
+	OpenValue     float64 `json:"open_value"`
+	RecoveryRate  float64 `json:"recovery_rate"`
+}
+
+// AbandonedStats counts abandoned carts by status. The recovery rate is the
+// share of closed carts that were recovered or converted into an order.
+func AbandonedStats(db *gorm.DB, since time.Time) (Stats, error) {
+	var rows []struct {
+		Status    string
+		Count     int64
+		Reminders int64
+		Value     float64
+	}
+	if err := db.Model(&models.AbandonedCart{}).
+		Select("status, COUNT(*) AS count, COALESCE(SUM(reminders_sent), 0) AS reminders, COALESCE(SUM(value), 0) AS value").
+		Where("created_at >= ?", since).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+	for _, row := range rows {
+		stats.RemindersSent += row.Reminders
+		switch row.Status {
+		case AbandonedOpen:
+			stats.Open = row.Count
+			stats.OpenValue = round(row.Value)
+		case AbandonedRecovered:
+			stats.Recovered = row.Count
+		case AbandonedConverted:
+			stats.Converted = row.Count
+		case AbandonedEmptied:
+			stats.Emptied = row.Count
+		case AbandonedExpired:
+			stats.Expired = row.Count
+		}
+	}
+
+	closed := stats.Recovered + stats.Converted + stats.Emptied + stats.Expired
+	if closed > 0 {
+		stats.RecoveryRate = round(float64(stats.Recovered+stats.Converted) / float64(closed))
+	}
+	return stats, nil
+}
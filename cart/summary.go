@@ -0,0 +1,157 @@
+package cart
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Warnings raised on a cart line.
+const (
+	WarningPriceChanged      = "price_changed"
+	WarningInsufficientStock = "insufficient_stock"
+	WarningUnavailable       = "unavailable"
+)
+
+var (
+	taxPercent            float64
+	shippingFlatRate      float64
+	freeShippingThreshold float64
+
+	appURL       string
+	abandonAfter = 24 * time.Hour
+	maxReminders = 2
+	expireAfter  = 30 * 24 * time.Hour
+)
+
+// Setup sets the tax and shipping used to estimate cart totals and when
+// carts count as abandoned or expire.
+func Setup(cfg *config.Config) {
+	taxPercent = cfg.TaxPercent
+	shippingFlatRate = cfg.ShippingFlatRate
+	freeShippingThreshold = cfg.FreeShippingThreshold
+
+	appURL = cfg.AppURL
+	abandonAfter = cfg.AbandonedCartAfter
+	maxReminders = cfg.AbandonedCartMaxReminders
+	expireAfter = cfg.CartExpiry
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Line is a cart line priced at the product's current price.
+type Line struct {
+	models.Cart
+	UnitPrice    float64   `json:"unit_price"`
+	RegularPrice float64   `json:"regular_price"`
+	LineTotal    float64   `json:"line_total"`
+	Discount     float64   `json:"discount"`
+	Available    int       `json:"available"`
+	Warnings     []Warning `json:"warnings"`
+}
+
+// Summary totals a cart. Subtotal is at regular prices and Discount is what
+// running sales take off it; tax and shipping are estimates.
+type Summary struct {
+	Items    int     `json:"items"`
+	Subtotal float64 `json:"subtotal"`
+	Discount float64 `json:"discount"`
+	Tax      float64 `json:"tax"`
+	Shipping float64 `json:"shipping"`
+	Total    float64 `json:"total"`
+	Warnings int     `json:"warnings"`
+}
+
+// Load fetches cart lines with their products, including products that have
+// since been deleted so those lines can be flagged.
+func Load(query *gorm.DB) ([]models.Cart, error) {
+	var items []models.Cart
+	err := query.Preload("Product", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Order("id").Find(&items).Error
+	return items, err
+}
+
+// Summarize prices cart lines and flags those whose price changed since they
+// were added, that ask for more than is available, or whose product can no
+// longer be bought. Unavailable lines are left out of the totals.
+func Summarize(db *gorm.DB, items []models.Cart, userID uint) ([]Line, Summary) {
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	reserved := inventory.Reserved(db, ids, userID)
+
+	lines := make([]Line, len(items))
+	var summary Summary
+	for i, item := range items {
+		product := item.Product
+		line := Line{Cart: item, Warnings: []Warning{}}
+
+		if product.ID == 0 || product.DeletedAt.Valid || product.Status != catalog.StatusPublished {
+			line.Warnings = append(line.Warnings, Warning{
+				Code:    WarningUnavailable,
+				Message: "This product is no longer available",
+			})
+			summary.Warnings++
+			lines[i] = line
+			continue
+		}
+
+		line.UnitPrice = product.Price
+		line.RegularPrice = product.Price
+		if product.CompareAtPrice != nil && *product.CompareAtPrice > product.Price {
+			line.RegularPrice = *product.CompareAtPrice
+		}
+		line.LineTotal = round(line.UnitPrice * float64(item.Quantity))
+		line.Discount = round((line.RegularPrice - line.UnitPrice) * float64(item.Quantity))
+
+		line.Available = product.Stock - reserved[product.ID]
+		if line.Available < 0 {
+			line.Available = 0
+		}
+
+		if item.PriceAtAdd != 0 && item.PriceAtAdd != product.Price {
+			line.Warnings = append(line.Warnings, Warning{
+				Code:    WarningPriceChanged,
+				Message: fmt.Sprintf("Price changed from %.2f to %.2f since you added it", item.PriceAtAdd, product.Price),
+			})
+		}
+		if line.Available < item.Quantity {
+			line.Warnings = append(line.Warnings, Warning{
+				Code:    WarningInsufficientStock,
+				Message: fmt.Sprintf("Only %d left in stock", line.Available),
+			})
+		}
+
+		summary.Items += item.Quantity
+		summary.Subtotal += line.RegularPrice * float64(item.Quantity)
+		summary.Discount += line.Discount
+		summary.Warnings += len(line.Warnings)
+		lines[i] = line
+	}
+
+	summary.Subtotal = round(summary.Subtotal)
+	summary.Discount = round(summary.Discount)
+	net := summary.Subtotal - summary.Discount
+	summary.Tax = round(net * taxPercent / 100)
+	if summary.Items > 0 && (freeShippingThreshold <= 0 || net < freeShippingThreshold) {
+		summary.Shipping = shippingFlatRate
+	}
+	summary.Total = round(net + summary.Tax + summary.Shipping)
+	return lines, summary
+}
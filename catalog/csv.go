@@ -0,0 +1,187 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Columns of the product CSV format, in export order. Only name and price are
+// required on import.
+var Columns = []string{"sku", "name", "description", "price", "stock", "category"}
+
+// Record is a product as it appears in a CSV or JSON export.
+type Record struct {
+	SKU         string  `json:"sku"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Stock       int     `json:"stock"`
+	Category    string  `json:"category"`
+}
+
+func NewRecord(product *models.Product) Record {
+	return Record{
+		SKU:         product.SKU,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Stock:       product.Stock,
+		Category:    product.Category,
+	}
+}
+
+// Row is one parsed CSV row. Description, Stock and Category are nil when the
+// file has no such column (or, for stock, leaves it empty), so an update keeps
+// the existing value. Err holds the reason a row failed validation.
+type Row struct {
+	Line        int
+	SKU         string
+	Name        string
+	Description *string
+	Price       float64
+	Stock       *int
+	Category    *string
+	Err         string
+}
+
+// ParseCSV reads product rows from a CSV file with a header line. Rows that
+// fail validation are returned with Err set; an error is returned only when
+// the file itself cannot be read.
+func ParseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+
+	var rows []Row
+	seen := make(map[string]int)
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			i, ok := index[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return unescapeCell(strings.TrimSpace(fields[i]))
+		}
+		optional := func(name string) *string {
+			if _, ok := index[name]; !ok {
+				return nil
+			}
+			value := field(name)
+			return &value
+		}
+
+		row := Row{
+			Line:        line,
+			SKU:         field("sku"),
+			Name:        field("name"),
+			Description: optional("description"),
+			Category:    optional("category"),
+		}
+		row.Err = validate(&row, field("price"), field("stock"))
+		if row.Err == "" && row.SKU != "" {
+			if first, ok := seen[row.SKU]; ok {
+				row.Err = fmt.Sprintf("duplicate sku, first seen on row %d", first)
+			} else {
+				seen[row.SKU] = line
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func validate(row *Row, price, stock string) string {
+	if row.Name == "" {
+		return "name is required"
+	}
+
+	var err error
+	row.Price, err = strconv.ParseFloat(price, 64)
+	if err != nil || row.Price <= 0 {
+		return "price must be a number greater than 0"
+	}
+
+	if stock != "" {
+		quantity, err := strconv.Atoi(stock)
+		if err != nil || quantity < 0 {
+			return "stock must be a whole number of at least 0"
+		}
+		row.Stock = &quantity
+	}
+	return ""
+}
+
+// formulaPrefixes are the characters that make a spreadsheet program read a
+// cell as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// CSVCell keeps spreadsheet programs from running a cell as a formula by
+// prefixing values that start with a formula character with a quote.
+func CSVCell(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCell drops the quote CSVCell adds, so exported files import back
+// unchanged.
+func unescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// WriteCSV writes products in the format ParseCSV reads. Text cells are
+// escaped with CSVCell.
+func WriteCSV(w io.Writer, products []models.Product) error {
+	writer := csv.NewWriter(w)
+	writer.Write(Columns)
+	for i := range products {
+		record := NewRecord(&products[i])
+		writer.Write([]string{
+			CSVCell(record.SKU),
+			CSVCell(record.Name),
+			CSVCell(record.Description),
+			strconv.FormatFloat(record.Price, 'f', -1, 64),
+			strconv.Itoa(record.Stock),
+			CSVCell(record.Category),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
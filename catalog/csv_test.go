@@ -0,0 +1,161 @@
+package catalog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Mug", "Mug"},
+		{"=SUM(A1:A9)", "'=SUM(A1:A9)"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@cmd", "'@cmd"},
+		{"\tx", "'\tx"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := CSVCell(tt.in); got != tt.want {
+			t.Errorf("CSVCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestWriteCSVRoundTrip writes products whose text starts with formula
+// characters and expects them escaped in the file and unchanged when the
+// file is read back.
+func TestWriteCSVRoundTrip(t *testing.T) {
+	products := []models.Product{
+		{SKU: "MUG-1", Name: "Mug", Description: "Plain", Price: 5, Stock: 3, Category: "kitchen"},
+		{SKU: "=1+1", Name: "@Plate", Description: "-50% off", Price: 7.5, Category: "+home"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, products); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"'=1+1", "'@Plate", "'-50% off", "'+home"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("export does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	rows, err := ParseCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(products) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(products))
+	}
+	for i, row := range rows {
+		product := products[i]
+		if row.Err != "" {
+			t.Fatalf("row %d: %s", i, row.Err)
+		}
+		if row.SKU != product.SKU || row.Name != product.Name || *row.Description != product.Description ||
+			row.Price != product.Price || *row.Stock != product.Stock || *row.Category != product.Category {
+			t.Errorf("row %d = %+v, want %+v", i, row, product)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+
+	tests := []struct {
+		name  string
+		input string
+		rows  []Row
+		err   string
+	}{
+		{name: "empty file", input: "", err: "file is empty"},
+		{name: "missing price column", input: "name\nMug\n", err: `missing "price" column`},
+		{
+			name:  "header with BOM, any case and order",
+			input: "\ufeffPrice, NAME ,sku\n5,Mug,M1\n",
+			rows:  []Row{{Line: 2, SKU: "M1", Name: "Mug", Price: 5}},
+		},
+		{
+			name:  "optional columns",
+			input: "name,price,description,stock,category\nMug, 5 ,Big,3,kitchen\nCup,2,,,\n",
+			rows: []Row{
+				{Line: 2, Name: "Mug", Price: 5, Description: str("Big"), Stock: num(3), Category: str("kitchen")},
+				{Line: 3, Name: "Cup", Price: 2, Description: str(""), Category: str("")},
+			},
+		},
+		{
+			name:  "short rows",
+			input: "sku,name,price,stock\nA,Mug,5\n",
+			rows:  []Row{{Line: 2, SKU: "A", Name: "Mug", Price: 5}},
+		},
+		{
+			name: "errors per row",
+			input: "sku,name,price,stock\n" +
+				"A,,5,\n" +
+				"B,Bowl,abc,1\n" +
+				"C,Cup,0,\n" +
+				"D,Dish,3,-1\n" +
+				"E,Egg cup,2.5,\n" +
+				"E,Egg cup,2.5,4\n",
+			rows: []Row{
+				{Line: 2, SKU: "A", Err: "name is required"},
+				{Line: 3, SKU: "B", Name: "Bowl", Err: "price must be a number greater than 0"},
+				{Line: 4, SKU: "C", Name: "Cup", Err: "price must be a number greater than 0"},
+				{Line: 5, SKU: "D", Name: "Dish", Price: 3, Err: "stock must be a whole number of at least 0"},
+				{Line: 6, SKU: "E", Name: "Egg cup", Price: 2.5},
+				{Line: 7, SKU: "E", Name: "Egg cup", Price: 2.5, Stock: num(4), Err: "duplicate sku, first seen on row 6"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseCSV(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.rows) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.rows))
+			}
+			for i := range rows {
+				if got, want := formatRow(rows[i]), formatRow(tt.rows[i]); got != want {
+					t.Errorf("row %d = %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// formatRow prints a row with the values its pointers refer to.
+func formatRow(row Row) string {
+	deref := func(p interface{}) string {
+		switch v := p.(type) {
+		case *string:
+			if v != nil {
+				return fmt.Sprintf("%q", *v)
+			}
+		case *int:
+			if v != nil {
+				return fmt.Sprint(*v)
+			}
+		}
+		return "nil"
+	}
+	return fmt.Sprintf("{line %d, sku %q, name %q, description %s, price %v, stock %s, category %s, err %q}",
+		row.Line, row.SKU, row.Name, deref(row.Description), row.Price, deref(row.Stock), deref(row.Category), row.Err)
+}
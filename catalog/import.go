@@ -0,0 +1,157 @@
+package catalog
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Row actions reported by Import.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionFailed = "failed"
+)
+
+var errDryRun = errors.New("dry run")
+
+// Result counts what an import did, with the outcome of every row.
+type Result struct {
+	Created int
+	Updated int
+	Failed  int
+	Rows    []models.ProductImportRow
+}
+
+// Import creates or updates an owner's products from parsed rows. Rows with
+// a SKU update the owner's product with that SKU if there is one. Each row is
+// applied in its own transaction, so a failing row does not stop the rest. A
+// dry run reports what would happen and then rolls everything back.
+func Import(db *gorm.DB, ownerID uint, rows []Row, dryRun bool) (Result, error) {
+	var result Result
+	run := func(conn *gorm.DB) {
+		for _, row := range rows {
+			report := models.ProductImportRow{Row: row.Line, SKU: row.SKU, Name: row.Name}
+
+			if row.Err != "" {
+				report.Action, report.Error = ActionFailed, row.Err
+			} else if err := conn.Transaction(func(tx *gorm.DB) error {
+				return apply(tx, ownerID, row, &report)
+			}); err != nil {
+				report.Action, report.Error = ActionFailed, err.Error()
+			}
+
+			switch report.Action {
+			case ActionCreate:
+				result.Created++
+			case ActionUpdate:
+				result.Updated++
+			default:
+				result.Failed++
+			}
+			result.Rows = append(result.Rows, report)
+		}
+	}
+
+	if !dryRun {
+		run(db)
+		return result, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		run(tx)
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return result, err
+}
+
+func apply(tx *gorm.DB, ownerID uint, row Row, report *models.ProductImportRow) error {
+	entry := models.StockMovement{
+		Type:    inventory.MovementImport,
+		Reason:  "csv_import",
+		ActorID: &ownerID,
+	}
+
+	var product models.Product
+	if row.SKU != "" {
+		tx.Where("owner_id = ? AND sku = ?", ownerID, row.SKU).Limit(1).Find(&product)
+	}
+
+	if product.ID == 0 {
+		product = models.Product{
+			Name:    row.Name,
+			Price:   row.Price,
+			SKU:     row.SKU,
+			OwnerID: ownerID,
+			Status:  StatusDraft,
+		}
+		if row.Description != nil {
+			product.Description = *row.Description
+		}
+		if row.Category != nil {
+			product.Category = *row.Category
+		}
+		if row.Stock != nil {
+			product.Stock = *row.Stock
+		}
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := RecordPrice(tx, &models.PriceChange{
+			ProductID: product.ID,
+			NewPrice:  product.Price,
+			Reason:    PriceInitial,
+			ActorID:   &ownerID,
+		}); err != nil {
+			return err
+		}
+
+		entry.ProductID = product.ID
+		entry.Delta = product.Stock
+		if err := inventory.Record(tx, &entry); err != nil {
+			return err
+		}
+		report.Action, report.ProductID = ActionCreate, product.ID
+		return nil
+	}
+
+	if row.Stock != nil && *row.Stock != product.Stock {
+		if inventory.HasStockLevels(tx, product.ID) {
+			return errors.New("stock is managed per warehouse; adjust it there")
+		}
+		if err := inventory.SetStock(tx, &product, *row.Stock, entry); err != nil {
+			return err
+		}
+	}
+
+	if row.Price != product.Price {
+		if product.CompareAtPrice != nil {
+			return ErrOnSale
+		}
+		if err := SetPrice(tx, &product, row.Price, models.PriceChange{
+			Reason:  PriceImport,
+			ActorID: &ownerID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{"name": row.Name}
+	if row.Description != nil {
+		updates["description"] = *row.Description
+	}
+	if row.Category != nil {
+		updates["category"] = *row.Category
+	}
+	if err := tx.Model(&product).Updates(updates).Error; err != nil {
+		return err
+	}
+	report.Action, report.ProductID = ActionUpdate, product.ID
+	return nil
+}
@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/testdb"
+)
+
+func TestImport(t *testing.T) {
+	const input = "sku,name,price,stock\n" +
+		"MUG,Big mug,6,4\n" +
+		"NEW,Plate,7,2\n" +
+		",,5,\n" +
+		"SALE,Sale item,9,8\n"
+
+	// Every row is reported the same way whether or not it is a dry run.
+	wantRows := []struct {
+		sku, action, err string
+	}{
+		{"MUG", ActionUpdate, ""},
+		{"NEW", ActionCreate, ""},
+		{"", ActionFailed, "name is required"},
+		{"SALE", ActionFailed, ErrOnSale.Error()},
+	}
+
+	// product is the expected state of a product after the import; missing
+	// means it should not exist.
+	type product struct {
+		name    string
+		price   float64
+		stock   int
+		missing bool
+	}
+	tests := []struct {
+		name      string
+		dryRun    bool
+		products  map[string]product
+		movements int64
+		changes   int64
+	}{
+		{
+			name:   "applied",
+			dryRun: false,
+			products: map[string]product{
+				"MUG":  {name: "Big mug", price: 6, stock: 4},
+				"NEW":  {name: "Plate", price: 7, stock: 2},
+				"SALE": {name: "Sale item", price: 8, stock: 1},
+			},
+			// MUG's stock and price change, and NEW is created with both.
+			// SALE's stock change is rolled back with the rest of its row.
+			movements: 2,
+			changes:   2,
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+			products: map[string]product{
+				"MUG":  {name: "Mug", price: 5, stock: 3},
+				"NEW":  {missing: true},
+				"SALE": {name: "Sale item", price: 8, stock: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.Open(t, &models.User{}, &models.Product{}, &models.PriceChange{},
+				&models.StockMovement{}, &models.StockLevel{})
+			owner := testdb.User(t, db, "seller@example.com")
+			mug := testdb.Product(t, db, owner.ID, "Mug", 5, 3)
+			sale := testdb.Product(t, db, owner.ID, "Sale item", 8, 1)
+			regular := 10.0
+			if err := db.Model(mug).Update("sku", "MUG").Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Model(sale).Updates(map[string]interface{}{"sku": "SALE", "compare_at_price": regular}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := ParseCSV(strings.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := Import(db, owner.ID, rows, tt.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Created != 1 || result.Updated != 1 || result.Failed != 2 {
+				t.Errorf("created %d, updated %d, failed %d; want 1, 1, 2", result.Created, result.Updated, result.Failed)
+			}
+			if len(result.Rows) != len(wantRows) {
+				t.Fatalf("got %d rows, want %d", len(result.Rows), len(wantRows))
+			}
+			for i, want := range wantRows {
+				row := result.Rows[i]
+				if row.SKU != want.sku || row.Action != want.action || row.Error != want.err {
+					t.Errorf("row %d = %+v, want sku %q, action %q, error %q", i, row, want.sku, want.action, want.err)
+				}
+			}
+
+			for sku, want := range tt.products {
+				var got models.Product
+				err := db.Where("owner_id = ? AND sku = ?", owner.ID, sku).First(&got).Error
+				if want.missing {
+					if !errors.Is(err, gorm.ErrRecordNotFound) {
+						t.Errorf("%s: got %+v, %v; want no product", sku, got, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", sku, err)
+				}
+				if got.Name != want.name || got.Price != want.price || got.Stock != want.stock {
+					t.Errorf("%s = %q at %v with %d in stock, want %q at %v with %d", sku,
+						got.Name, got.Price, got.Stock, want.name, want.price, want.stock)
+				}
+			}
+
+			var movements, changes int64
+			if err := db.Model(&models.StockMovement{}).Count(&movements).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Model(&models.PriceChange{}).Count(&changes).Error; err != nil {
+				t.Fatal(err)
+			}
+			if movements != tt.movements || changes != tt.changes {
+				t.Errorf("%d stock movements and %d price changes, want %d and %d", movements, changes, tt.movements, tt.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package catalog
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Product statuses. Only published products are listed to other users and
+// can be bought.
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// Visible limits a product query to what a user may see: published products,
+// their own products, or everything for an admin.
+func Visible(db *gorm.DB, userID uint, role string) *gorm.DB {
+	if role == "admin" {
+		return db
+	}
+	return db.Where("products.status = ? OR products.owner_id = ?", StatusPublished, userID)
+}
+
+// ApplySchedules publishes drafts whose publish_at has come and takes
+// published products whose unpublish_at has come back to draft.
+func ApplySchedules(db *gorm.DB) error {
+	now := time.Now()
+
+	published := db.Model(&models.Product{}).
+		Where("status = ? AND publish_at <= ?", StatusDraft, now).
+		Updates(map[string]interface{}{"status": StatusPublished, "publish_at": nil})
+	if published.Error != nil {
+		return published.Error
+	}
+
+	unpublished := db.Model(&models.Product{}).
+		Where("status = ? AND unpublish_at <= ?", StatusPublished, now).
+		Updates(map[string]interface{}{"status": StatusDraft, "unpublish_at": nil})
+	if unpublished.Error != nil {
+		return unpublished.Error
+	}
+
+	if published.RowsAffected > 0 || unpublished.RowsAffected > 0 {
+		log.Printf("Published %d and unpublished %d scheduled products", published.RowsAffected, unpublished.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package catalog
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Reasons a price changed.
+const (
+	PriceInitial   = "initial"
+	PriceManual    = "manual"
+	PriceImport    = "import"
+	PriceScheduled = "scheduled"
+	PriceSaleStart = "sale_start"
+	PriceSaleEnd   = "sale_end"
+)
+
+// Scheduled price statuses. A sale is active between its start and end; a
+// price change without an end goes straight from pending to completed.
+const (
+	SchedulePending   = "pending"
+	ScheduleActive    = "active"
+	ScheduleCompleted = "completed"
+	ScheduleCancelled = "cancelled"
+)
+
+var (
+	ErrOnSale          = errors.New("product is on sale; cancel the sale before changing its price")
+	ErrScheduleOverlap = errors.New("a sale is already scheduled for that time")
+)
+
+// RecordPrice appends a change to a product's price history.
+func RecordPrice(tx *gorm.DB, change *models.PriceChange) error {
+	return tx.Create(change).Error
+}
+
+// SetPrice changes a product's price and records the change. Nothing is
+// recorded if the price stays the same.
+func SetPrice(tx *gorm.DB, product *models.Product, price float64, change models.PriceChange) error {
+	if price == product.Price {
+		return nil
+	}
+	change.ProductID = product.ID
+	change.OldPrice = product.Price
+	change.NewPrice = price
+	if err := tx.Model(product).UpdateColumn("price", price).Error; err != nil {
+		return err
+	}
+	product.Price = price
+	return RecordPrice(tx, &change)
+}
+
+// CheckSchedule reports ErrScheduleOverlap if a new scheduled price would
+// take effect while a sale of the same product runs. Sales may not overlap
+// each other or any other scheduled change.
+func CheckSchedule(db *gorm.DB, productID uint, startsAt time.Time, endsAt *time.Time) error {
+	query := db.Model(&models.ScheduledPrice{}).
+		Where("product_id = ? AND status IN ?", productID, []string{SchedulePending, ScheduleActive})
+
+	if endsAt == nil {
+		query = query.Where("ends_at IS NOT NULL AND starts_at <= ? AND ends_at > ?", startsAt, startsAt)
+	} else {
+		query = query.Where("starts_at < ? AND (ends_at IS NULL AND starts_at >= ? OR ends_at > ?)", *endsAt, startsAt, startsAt)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrScheduleOverlap
+	}
+	return nil
+}
+
+// priceEvent is a scheduled price starting or a sale ending.
+type priceEvent struct {
+	at       time.Time
+	end      bool
+	schedule *models.ScheduledPrice
+}
+
+// ApplyPriceSchedules starts scheduled prices whose time has come and ends
+// sales that are over. After downtime several starts and ends can be due at
+// once, so they are applied in the order they should have happened.
+func ApplyPriceSchedules(db *gorm.DB) error {
+	now := time.Now()
+
+	var schedules []models.ScheduledPrice
+	if err := db.Where("status = ? AND starts_at <= ?", SchedulePending, now).
+		Or("status = ? AND ends_at <= ?", ScheduleActive, now).
+		Find(&schedules).Error; err != nil {
+		return err
+	}
+
+	var events []priceEvent
+	for i := range schedules {
+		schedule := &schedules[i]
+		if schedule.Status == SchedulePending {
+			events = append(events, priceEvent{at: schedule.StartsAt, schedule: schedule})
+		}
+		if schedule.EndsAt != nil && !schedule.EndsAt.After(now) {
+			events = append(events, priceEvent{at: *schedule.EndsAt, end: true, schedule: schedule})
+		}
+	}
+
+	// A sale ending at the same time as a price change starts goes first, so
+	// the change is applied to the regular price.
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		if events[i].end != events[j].end {
+			return events[i].end
+		}
+		return events[i].schedule.ID < events[j].schedule.ID
+	})
+
+	started, ended := 0, 0
+	for _, event := range events {
+		if event.end {
+			// The sale may have been cancelled when it was due to start.
+			if event.schedule.Status != ScheduleActive {
+				continue
+			}
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				return EndSale(tx, event.schedule, nil, ScheduleCompleted)
+			}); err != nil {
+				return err
+			}
+			ended++
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return startSchedule(tx, event.schedule)
+		}); err != nil {
+			return err
+		}
+		started++
+	}
+
+	if started+ended > 0 {
+		log.Printf("Started %d scheduled prices and ended %d sales", started, ended)
+	}
+	return nil
+}
+
+func startSchedule(tx *gorm.DB, schedule *models.ScheduledPrice) error {
+	var product models.Product
+	if err := tx.First(&product, schedule.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Model(schedule).Update("status", ScheduleCancelled).Error
+		}
+		return err
+	}
+
+	change := models.PriceChange{Reason: PriceScheduled, ScheduledPriceID: &schedule.ID}
+	status := ScheduleCompleted
+
+	if schedule.EndsAt != nil {
+		regular := product.Price
+		if err := tx.Model(&product).Updates(map[string]interface{}{
+			"compare_at_price": regular,
+			"sale_ends_at":     schedule.EndsAt,
+		}).Error; err != nil {
+			return err
+		}
+		change.Reason = PriceSaleStart
+		status = ScheduleActive
+	}
+
+	if err := SetPrice(tx, &product, schedule.Price, change); err != nil {
+		return err
+	}
+	return tx.Model(schedule).Update("status", status).Error
+}
+
+// EndSale puts a product on an active sale back to its regular price and
+// leaves the sale with the given status. Deleted products are put back too,
+// so they are at their regular price if they are restored.
+func EndSale(tx *gorm.DB, sale *models.ScheduledPrice, actorID *uint, status string) error {
+	unscoped := tx.Unscoped().Session(&gorm.Session{})
+	var product models.Product
+	err := unscoped.First(&product, sale.ProductID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err == nil && product.CompareAtPrice != nil {
+		regular := *product.CompareAtPrice
+		if err := unscoped.Model(&product).Updates(map[string]interface{}{
+			"compare_at_price": nil,
+			"sale_ends_at":     nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := SetPrice(unscoped, &product, regular, models.PriceChange{
+			Reason:           PriceSaleEnd,
+			ActorID:          actorID,
+			ScheduledPriceID: &sale.ID,
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Model(sale).Update("status", status).Error
+}
@@ -0,0 +1,156 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/testdb"
+)
+
+// TestApplyPriceSchedulesCatchUp applies several schedules that all fell due
+// while the job was not running, and expects the same result as if it had
+// run at every step.
+func TestApplyPriceSchedulesCatchUp(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) time.Time { return now.Add(d) }
+	ends := func(d time.Duration) *time.Time { t := at(d); return &t }
+
+	tests := []struct {
+		name      string
+		schedules []models.ScheduledPrice
+		price     float64
+		compareAt *float64
+		statuses  []string
+		reasons   []string
+	}{
+		{
+			name: "sale over, then a price change, then a running sale",
+			schedules: []models.ScheduledPrice{
+				{Price: 80, StartsAt: at(-3 * time.Hour), EndsAt: ends(-2 * time.Hour)},
+				{Price: 120, StartsAt: at(-time.Hour)},
+				{Price: 90, StartsAt: at(-30 * time.Minute), EndsAt: ends(time.Hour)},
+			},
+			price:     90,
+			compareAt: func() *float64 { v := 120.0; return &v }(),
+			statuses:  []string{ScheduleCompleted, ScheduleCompleted, ScheduleActive},
+			reasons:   []string{PriceSaleStart, PriceSaleEnd, PriceScheduled, PriceSaleStart},
+		},
+		{
+			name: "price change as a sale ends",
+			schedules: []models.ScheduledPrice{
+				{Price: 120, StartsAt: at(-time.Hour)},
+				{Price: 80, StartsAt: at(-2 * time.Hour), EndsAt: ends(-time.Hour)},
+			},
+			price:    120,
+			statuses: []string{ScheduleCompleted, ScheduleCompleted},
+			reasons:  []string{PriceSaleStart, PriceSaleEnd, PriceScheduled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.Open(t, &models.User{}, &models.Product{}, &models.PriceChange{}, &models.ScheduledPrice{})
+			owner := testdb.User(t, db, "seller@example.com")
+			product := testdb.Product(t, db, owner.ID, "Mug", 100, 1)
+			for i := range tt.schedules {
+				tt.schedules[i].ProductID = product.ID
+				tt.schedules[i].CreatedByID = owner.ID
+				if err := db.Create(&tt.schedules[i]).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := ApplyPriceSchedules(db); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.First(product, product.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if product.Price != tt.price {
+				t.Errorf("price = %v, want %v", product.Price, tt.price)
+			}
+			switch {
+			case tt.compareAt == nil && product.CompareAtPrice != nil:
+				t.Errorf("compare_at_price = %v, want none", *product.CompareAtPrice)
+			case tt.compareAt != nil && (product.CompareAtPrice == nil || *product.CompareAtPrice != *tt.compareAt):
+				t.Errorf("compare_at_price = %v, want %v", product.CompareAtPrice, *tt.compareAt)
+			}
+
+			for i, want := range tt.statuses {
+				var schedule models.ScheduledPrice
+				if err := db.First(&schedule, tt.schedules[i].ID).Error; err != nil {
+					t.Fatal(err)
+				}
+				if schedule.Status != want {
+					t.Errorf("schedule %d status = %q, want %q", i, schedule.Status, want)
+				}
+			}
+
+			var changes []models.PriceChange
+			if err := db.Where("product_id = ?", product.ID).Order("id").Find(&changes).Error; err != nil {
+				t.Fatal(err)
+			}
+			var reasons []string
+			for _, change := range changes {
+				reasons = append(reasons, change.Reason)
+			}
+			if len(reasons) != len(tt.reasons) {
+				t.Fatalf("price changes = %v, want %v", reasons, tt.reasons)
+			}
+			for i := range reasons {
+				if reasons[i] != tt.reasons[i] {
+					t.Fatalf("price changes = %v, want %v", reasons, tt.reasons)
+				}
+			}
+		})
+	}
+}
+
+// TestEndSaleOfDeletedProduct ends a sale after its product was deleted and
+// expects the product back at its regular price, ready to be restored.
+func TestEndSaleOfDeletedProduct(t *testing.T) {
+	db := testdb.Open(t, &models.User{}, &models.Product{}, &models.PriceChange{}, &models.ScheduledPrice{})
+	owner := testdb.User(t, db, "seller@example.com")
+	product := testdb.Product(t, db, owner.ID, "Mug", 100, 1)
+
+	endsAt := time.Now().Add(-time.Hour)
+	sale := models.ScheduledPrice{
+		ProductID:   product.ID,
+		CreatedByID: owner.ID,
+		Price:       80,
+		StartsAt:    endsAt.Add(-time.Hour),
+		EndsAt:      &endsAt,
+	}
+	if err := db.Create(&sale).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return startSchedule(tx, &sale)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApplyPriceSchedules(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Unscoped().First(product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if product.Price != 100 || product.CompareAtPrice != nil {
+		t.Errorf("price = %v, compare_at_price = %v; want 100, none", product.Price, product.CompareAtPrice)
+	}
+	if err := db.First(&sale, sale.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sale.Status != ScheduleCompleted {
+		t.Errorf("sale status = %q, want %q", sale.Status, ScheduleCompleted)
+	}
+}
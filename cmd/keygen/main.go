@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// keygen writes a new JWT signing key named after the current UTC time, so the
+// newest key sorts last and becomes the active key on the next restart. With
+// -retire it replaces an old private key by its public half, which keeps
+// verifying tokens it signed without being able to sign new ones.
+func main() {
+	alg := flag.String("alg", "RS256", "signing algorithm: RS256 or EdDSA")
+	dir := flag.String("dir", "keys", "directory to write the key to")
+	retire := flag.String("retire", "", "key id to retire to verify-only")
+	flag.Parse()
+
+	if *retire != "" {
+		retireKey(*dir, *retire)
+		return
+	}
+
+	var privateKey interface{}
+	var err error
+	switch *alg {
+	case "RS256":
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		log.Fatalf("Unsupported algorithm %q", *alg)
+	}
+	if err != nil {
+		log.Fatal("Failed to generate key:", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		log.Fatal("Failed to encode key:", err)
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		log.Fatal("Failed to create keys directory:", err)
+	}
+
+	kid := time.Now().UTC().Format("20060102T150405Z")
+	path := filepath.Join(*dir, kid+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		log.Fatal("Failed to write key:", err)
+	}
+
+	log.Printf("Generated %s key %s at %s", *alg, kid, path)
+}
+
+func retireKey(dir, kid string) {
+	path := filepath.Join(dir, kid+".pem")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Failed to read key:", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		log.Fatal("Invalid PEM data in ", path)
+	}
+
+	var privateKey interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		log.Fatal("Failed to parse key:", err)
+	}
+
+	var publicKey interface{}
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		publicKey = &key.PublicKey
+	case ed25519.PrivateKey:
+		publicKey = key.Public()
+	default:
+		log.Fatal("Unsupported key type")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		log.Fatal("Failed to encode public key:", err)
+	}
+
+	pubPath := filepath.Join(dir, kid+".pub.pem")
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		log.Fatal("Failed to write public key:", err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Fatal("Failed to remove private key:", err)
+	}
+
+	log.Printf("Retired key %s, public key kept at %s", kid, pubPath)
+}
@@ -6,6 +6,7 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/orders"
 )
 
 func main() {
@@ -20,9 +21,42 @@ func main() {
 		&models.Cart{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.LoginThrottle{},
+		&models.APIKey{},
+		&models.DataExport{},
+		&models.SellerProfile{},
+		&models.SellerOrder{},
+		&models.CommissionRate{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.Payout{},
+		&models.Reservation{},
+		&models.Warehouse{},
+		&models.StockLevel{},
+		&models.StockAllocation{},
+		&models.StockMovement{},
+		&models.StockSubscription{},
+		&models.ProductImport{},
+		&models.PriceChange{},
+		&models.ScheduledPrice{},
+		&models.Wishlist{},
+		&models.WishlistItem{},
+		&models.AbandonedCart{},
+		&models.Sequence{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.DailySalesRollup{},
 	); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	count, err := orders.BackfillSellerOrders(db)
+	if err != nil {
+		log.Fatal("Failed to backfill seller orders:", err)
+	}
+	if count > 0 {
+		log.Printf("Split %d existing orders into seller orders", count)
+	}
+
 	log.Println("Database migration completed successfully!")
 }
\ No newline at end of file
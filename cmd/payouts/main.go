@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/ledger"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// payouts pays out every seller's outstanding balance in one batch and writes
+// a CSV settlement file for the bank transfer.
+func main() {
+	batch := time.Now().UTC().Format("20060102T150405Z")
+	out := flag.String("out", filepath.Join("settlements", "payouts-"+batch+".csv"), "settlement CSV file to write")
+	min := flag.Float64("min", 1, "minimum balance to pay out")
+	dryRun := flag.Bool("dry-run", false, "list payouts without recording them")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	db, err := gorm.Open(sqlite.Open(cfg.DatabasePath), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	balances, err := ledger.SellersWithBalance(db, *min)
+	if err != nil {
+		log.Fatal("Failed to fetch seller balances:", err)
+	}
+	if len(balances) == 0 {
+		log.Println("No seller balances to pay out")
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*out), 0o755); err != nil {
+		log.Fatal("Failed to create settlement directory:", err)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal("Failed to create settlement file:", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"payout_id", "batch", "seller_id", "store_name", "email", "amount"})
+
+	var total float64
+	paid := 0
+	for _, balance := range balances {
+		var user models.User
+		db.Unscoped().First(&user, balance.SellerID)
+		var profile models.SellerProfile
+		db.Where("user_id = ?", balance.SellerID).Limit(1).Find(&profile)
+
+		payout := models.Payout{
+			SellerID: balance.SellerID,
+			Amount:   balance.Balance,
+			Batch:    batch,
+		}
+		if !*dryRun {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&payout).Error; err != nil {
+					return err
+				}
+				return ledger.RecordPayout(tx, &payout)
+			})
+			if err != nil {
+				log.Printf("Failed to pay out seller %d: %v", balance.SellerID, err)
+				continue
+			}
+		}
+
+		writer.Write([]string{
+			strconv.FormatUint(uint64(payout.ID), 10),
+			batch,
+			strconv.FormatUint(uint64(balance.SellerID), 10),
+			profile.StoreName,
+			user.Email,
+			fmt.Sprintf("%.2f", payout.Amount),
+		})
+		total += payout.Amount
+		paid++
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatal("Failed to write settlement file:", err)
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: %d payouts totalling %.2f written to %s", paid, total, *out)
+		return
+	}
+	log.Printf("Batch %s: %d payouts totalling %.2f written to %s", batch, paid, total, *out)
+}
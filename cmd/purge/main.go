@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// purge permanently deletes products, users, cart and wishlist items and API
+// keys that were soft-deleted more than -days ago. Products and users still
+// referenced by an order are kept.
+func main() {
+	days := flag.Int("days", 30, "purge records deleted more than this many days ago")
+	dryRun := flag.Bool("dry-run", false, "report what would be purged without deleting anything")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	db, err := gorm.Open(sqlite.Open(cfg.DatabasePath), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -*days)
+	log.Printf("Purging records deleted before %s", cutoff.Format(time.RFC3339))
+
+	purged, skipped, err := purgeProducts(db, cutoff, *dryRun)
+	if err != nil {
+		log.Fatal("Failed to purge products:", err)
+	}
+	log.Printf("Products: %d purged, %d kept because they were ordered", purged, skipped)
+
+	purged, skipped, err = purgeUsers(db, cutoff, *dryRun)
+	if err != nil {
+		log.Fatal("Failed to purge users:", err)
+	}
+	log.Printf("Users: %d purged, %d kept because orders, products or the ledger refer to them", purged, skipped)
+
+	for _, model := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"Cart items", &models.Cart{}},
+		{"API keys", &models.APIKey{}},
+		{"Wishlist items", &models.WishlistItem{}},
+	} {
+		query := db.Unscoped().Where("deleted_at < ?", cutoff)
+		if *dryRun {
+			var count int64
+			query.Model(model.value).Count(&count)
+			log.Printf("%s: %d purged", model.name, count)
+			continue
+		}
+		result := query.Delete(model.value)
+		if result.Error != nil {
+			log.Fatalf("Failed to purge %s: %v", model.name, result.Error)
+		}
+		log.Printf("%s: %d purged", model.name, result.RowsAffected)
+	}
+
+	if *dryRun {
+		log.Println("Dry run: nothing was deleted")
+	}
+}
+
+func purgeProducts(db *gorm.DB, cutoff time.Time, dryRun bool) (int, int, error) {
+	var products []models.Product
+	if err := db.Unscoped().Where("deleted_at < ?", cutoff).Find(&products).Error; err != nil {
+		return 0, 0, err
+	}
+
+	purged, skipped := 0, 0
+	for _, product := range products {
+		var ordered int64
+		db.Model(&models.OrderItem{}).Unscoped().Where("product_id = ?", product.ID).Count(&ordered)
+		if ordered > 0 {
+			skipped++
+			continue
+		}
+		if dryRun {
+			purged++
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Stock movements and price changes refuse deletion through their
+			// hooks; purging a product is the one place its history goes with it.
+			for _, history := range []interface{}{&models.StockMovement{}, &models.PriceChange{}} {
+				if err := tx.Session(&gorm.Session{SkipHooks: true}).
+					Where("product_id = ?", product.ID).
+					Delete(history).Error; err != nil {
+					return err
+				}
+			}
+			for _, related := range []interface{}{
+				&models.ScheduledPrice{},
+				&models.WishlistItem{},
+				&models.StockLevel{},
+				&models.Reservation{},
+				&models.StockSubscription{},
+				&models.Cart{},
+			} {
+				if err := tx.Unscoped().Where("product_id = ?", product.ID).Delete(related).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Unscoped().Delete(&product).Error
+		})
+		if err != nil {
+			return purged, skipped, err
+		}
+		purged++
+	}
+	return purged, skipped, nil
+}
+
+func purgeUsers(db *gorm.DB, cutoff time.Time, dryRun bool) (int, int, error) {
+	var users []models.User
+	if err := db.Unscoped().Where("deleted_at < ?", cutoff).Find(&users).Error; err != nil {
+		return 0, 0, err
+	}
+
+	purged, skipped := 0, 0
+	for _, user := range users {
+		if referenced(db, user.ID) {
+			skipped++
+			continue
+		}
+		if dryRun {
+			purged++
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().
+				Where("wishlist_id IN (?)", tx.Unscoped().Model(&models.Wishlist{}).Select("id").Where("user_id = ?", user.ID)).
+				Delete(&models.WishlistItem{}).Error; err != nil {
+				return err
+			}
+			for _, related := range []interface{}{
+				&models.Cart{},
+				&models.Wishlist{},
+				&models.AbandonedCart{},
+				&models.APIKey{},
+				&models.DataExport{},
+				&models.SellerProfile{},
+				&models.Reservation{},
+				&models.StockSubscription{},
+				&models.ProductImport{},
+			} {
+				if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(related).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Unscoped().Delete(&user).Error
+		})
+		if err != nil {
+			return purged, skipped, err
+		}
+		purged++
+	}
+	return purged, skipped, nil
+}
+
+// referenced reports whether orders, products or the seller ledger still
+// point at a user.
+func referenced(db *gorm.DB, userID uint) bool {
+	checks := []struct {
+		model  interface{}
+		column string
+	}{
+		{&models.Order{}, "user_id"},
+		{&models.OrderItem{}, "seller_id"},
+		{&models.SellerOrder{}, "seller_id"},
+		{&models.Product{}, "owner_id"},
+		{&models.LedgerEntry{}, "seller_id"},
+		{&models.Payout{}, "seller_id"},
+	}
+	for _, check := range checks {
+		var count int64
+		db.Unscoped().Model(check.model).Where(check.column+" = ?", userID).Count(&count)
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
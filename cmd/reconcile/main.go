@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/inventory"
+)
+
+// reconcile recomputes stock from the stock movement ledger and reports any
+// product or warehouse whose stock has drifted from it.
+func main() {
+	seed := flag.Bool("seed", false, "record opening balances for products without stock movements")
+	apply := flag.Bool("apply", false, "overwrite drifted stock with the ledger values")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	db, err := gorm.Open(sqlite.Open(cfg.DatabasePath), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	if *seed {
+		count, err := inventory.SeedOpeningBalances(db)
+		if err != nil {
+			log.Fatal("Failed to record opening balances:", err)
+		}
+		log.Printf("Recorded opening balances for %d products", count)
+	}
+
+	drifts, err := inventory.Reconcile(db)
+	if err != nil {
+		log.Fatal("Failed to reconcile stock:", err)
+	}
+	if len(drifts) == 0 {
+		log.Println("Stock matches the ledger")
+		return
+	}
+
+	for _, drift := range drifts {
+		if drift.WarehouseID == nil {
+			log.Printf("Product %d: stock %d, ledger %d (drift %+d)",
+				drift.ProductID, drift.Recorded, drift.Ledger, drift.Recorded-drift.Ledger)
+		} else {
+			log.Printf("Product %d in warehouse %d: stock %d, ledger %d (drift %+d)",
+				drift.ProductID, *drift.WarehouseID, drift.Recorded, drift.Ledger, drift.Recorded-drift.Ledger)
+		}
+
+		if *apply {
+			if err := inventory.ApplyDrift(db, drift); err != nil {
+				log.Fatal("Failed to correct stock:", err)
+			}
+		}
+	}
+
+	if *apply {
+		log.Printf("Corrected %d stock figures from the ledger", len(drifts))
+		return
+	}
+	log.Printf("%d stock figures drifted from the ledger; run with -apply to correct them", len(drifts))
+	os.Exit(1)
+}
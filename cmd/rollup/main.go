@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/reports"
+)
+
+// rollup rebuilds the daily sales rollups of the last -days complete days,
+// for example to backfill them after the first deploy. The server keeps the
+// most recent REPORT_ROLLUP_DAYS up to date on its own.
+func main() {
+	days := flag.Int("days", 90, "rebuild the rollups of this many past days")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	db, err := gorm.Open(sqlite.Open(cfg.DatabasePath), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	count, err := reports.Rollup(db, *days)
+	if err != nil {
+		log.Fatal("Failed to roll up daily sales:", err)
+	}
+	log.Printf("Rolled up %d days of sales", count)
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +15,58 @@ type Config struct {
 	ServerPort   string
 	DatabasePath string
 	JWTSecret    string
+	AppURL       string
+
+	JWTAlgorithm   string
+	JWTKeysDir     string
+	JWTActiveKeyID string
+	JWTIssuer      string
+	JWTAudience    string
+
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginAttemptWindow time.Duration
+	LoginLockoutBase   time.Duration
+	LoginLockoutMax    time.Duration
+
+	EmailVerificationTTL time.Duration
+
+	ExportDir           string
+	ExportLinkTTL       time.Duration
+	ExportSweepInterval time.Duration
+
+	CommissionPercent float64
+
+	ReservationMode          string
+	ReservationTTL           time.Duration
+	OrderPaymentTTL          time.Duration
+	ReservationSweepInterval time.Duration
+
+	AllocationStrategy string
+
+	StockAlertInterval time.Duration
+
+	ImportAsyncRows int
+	ImportMaxBytes  int
+
+	PublishScheduleInterval time.Duration
+
+	CartTokenSecret string
+
+	TaxPercent            float64
+	ShippingFlatRate      float64
+	FreeShippingThreshold float64
+
+	AbandonedCartAfter        time.Duration
+	AbandonedCartMaxReminders int
+	AbandonedCartInterval     time.Duration
+	CartExpiry                time.Duration
+
+	StoreName    string
+	StoreAddress string
+
+	ReportRollupInterval time.Duration
+	ReportRollupDays     int
 }
 
 func LoadConfig() *Config {
@@ -23,19 +79,130 @@ func LoadConfig() *Config {
 		ServerPort:   getEnv("SERVER_PORT", "8000"),
 		DatabasePath: getEnv("DATABASE_PATH", "ecommerce.db"),
 		JWTSecret:    getEnv("JWT_SECRET", "your-secret-key"),
+		AppURL:       getEnv("APP_URL", "http://localhost:8000"),
+
+		JWTAlgorithm:   getEnv("JWT_ALGORITHM", "HS256"),
+		JWTKeysDir:     getEnv("JWT_KEYS_DIR", "keys"),
+		JWTActiveKeyID: getEnv("JWT_ACTIVE_KID", ""),
+		JWTIssuer:      getEnv("JWT_ISSUER", "golang-tutorial"),
+		JWTAudience:    getEnv("JWT_AUDIENCE", "golang-tutorial-api"),
+
+		LoginMaxAttempts:   getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginIPMaxAttempts: getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+		LoginAttemptWindow: getEnvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour),
+		LoginLockoutBase:   getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:    getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+
+		EmailVerificationTTL: getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+
+		ExportDir:           getEnv("EXPORT_DIR", "exports"),
+		ExportLinkTTL:       getEnvDuration("EXPORT_LINK_TTL", 24*time.Hour),
+		ExportSweepInterval: getEnvDuration("EXPORT_SWEEP_INTERVAL", time.Hour),
+
+		CommissionPercent: getEnvFloat("COMMISSION_PERCENT", 10),
+
+		ReservationMode:          getEnv("RESERVATION_MODE", "checkout"),
+		ReservationTTL:           getEnvDuration("RESERVATION_TTL", 15*time.Minute),
+		OrderPaymentTTL:          getEnvDuration("ORDER_PAYMENT_TTL", 24*time.Hour),
+		ReservationSweepInterval: getEnvDuration("RESERVATION_SWEEP_INTERVAL", time.Minute),
+
+		AllocationStrategy: getEnv("ALLOCATION_STRATEGY", "most_stocked"),
+
+		StockAlertInterval: getEnvDuration("STOCK_ALERT_INTERVAL", time.Minute),
+
+		ImportAsyncRows: getEnvInt("IMPORT_ASYNC_ROWS", 200),
+		ImportMaxBytes:  getEnvInt("IMPORT_MAX_BYTES", 10<<20),
+
+		PublishScheduleInterval: getEnvDuration("PUBLISH_SCHEDULE_INTERVAL", time.Minute),
+
+		CartTokenSecret: getEnv("CART_TOKEN_SECRET", ""),
+
+		TaxPercent:            getEnvFloat("TAX_PERCENT", 0),
+		ShippingFlatRate:      getEnvFloat("SHIPPING_FLAT_RATE", 0),
+		FreeShippingThreshold: getEnvFloat("FREE_SHIPPING_THRESHOLD", 0),
+
+		AbandonedCartAfter:        getEnvDuration("ABANDONED_CART_AFTER", 24*time.Hour),
+		AbandonedCartMaxReminders: getEnvInt("ABANDONED_CART_MAX_REMINDERS", 2),
+		AbandonedCartInterval:     getEnvDuration("ABANDONED_CART_INTERVAL", 15*time.Minute),
+		CartExpiry:                getEnvDuration("CART_EXPIRY", 30*24*time.Hour),
+
+		StoreName:    getEnv("STORE_NAME", "Golang Tutorial Store"),
+		StoreAddress: getEnv("STORE_ADDRESS", ""),
+
+		ReportRollupInterval: getEnvDuration("REPORT_ROLLUP_INTERVAL", time.Hour),
+		ReportRollupDays:     getEnvInt("REPORT_ROLLUP_DAYS", 7),
+	}
+
+	// The JWT secret only doubles as the cart token secret when it is really
+	// used to sign tokens and is not the public default. Otherwise a random
+	// secret is used, and guest cart tokens stop working on restart.
+	if config.CartTokenSecret == "" {
+		if config.JWTAlgorithm == "HS256" && config.JWTSecret != "your-secret-key" {
+			config.CartTokenSecret = config.JWTSecret
+		} else {
+			config.CartTokenSecret = randomSecret()
+			log.Println("Warning: CART_TOKEN_SECRET is not set; using a random secret, so guest carts are lost on restart.")
+		}
 	}
 
 	// Validate required environment variables
-	if config.JWTSecret == "your-secret-key" {
+	if config.JWTAlgorithm == "HS256" && config.JWTSecret == "your-secret-key" {
 		log.Println("Warning: Using default JWT secret. Please set JWT_SECRET in your environment variables for production.")
 	}
 
 	return config
 }
 
+func randomSecret() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatal("Failed to generate a secret:", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid integer for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Warning: invalid number for %s, using default %g", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration for %s, using default %s", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
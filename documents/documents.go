@@ -0,0 +1,336 @@
+// Package documents renders the PDFs that go with an order: the customer's
+// invoice and the packing slip the warehouse ships with the parcel.
+package documents
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/ledger"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/pdf"
+)
+
+var (
+	storeName    = "Golang Tutorial Store"
+	storeAddress string
+)
+
+// Setup sets the store details printed at the top of every document.
+func Setup(cfg *config.Config) {
+	storeName = cfg.StoreName
+	storeAddress = cfg.StoreAddress
+}
+
+const (
+	margin     = 50.0
+	bottom     = 70.0
+	lineHeight = 16.0
+)
+
+// column is one column of an item table. Right-aligned columns are anchored
+// at their right edge.
+type column struct {
+	title string
+	x     float64
+	width float64
+	right bool
+}
+
+// writer lays out a document top to bottom, starting a new page, with the
+// table header repeated, when a page runs out.
+type writer struct {
+	doc     *pdf.Document
+	page    *pdf.Page
+	y       float64
+	heading string
+	columns []column
+}
+
+func newWriter(title, heading string) *writer {
+	w := &writer{doc: pdf.New(title), heading: heading}
+	w.newPage()
+	return w
+}
+
+func (w *writer) newPage() {
+	w.page = w.doc.AddPage()
+	w.y = pdf.PageHeight - margin
+
+	w.page.Text(margin, w.y-14, 18, true, storeName)
+	w.page.TextRight(pdf.PageWidth-margin, w.y-14, 18, true, w.heading)
+	w.y -= 32
+	for _, line := range strings.Split(storeAddress, ",") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.page.Text(margin, w.y, 9, false, line)
+			w.y -= 12
+		}
+	}
+	w.y -= 8
+	w.page.Line(margin, w.y, pdf.PageWidth-margin, w.y, 1)
+	w.y -= 24
+
+	if w.columns != nil {
+		w.tableHeader()
+	}
+}
+
+// space makes sure height points are left on the page.
+func (w *writer) space(height float64) {
+	if w.y-height < bottom {
+		w.newPage()
+	}
+}
+
+func (w *writer) text(size float64, bold bool, s string) {
+	w.space(lineHeight)
+	w.page.Text(margin, w.y, size, bold, s)
+	w.y -= size + 5
+}
+
+// field writes a label and its value on one line.
+func (w *writer) field(label, value string) {
+	w.space(lineHeight)
+	w.page.Text(margin, w.y, 10, true, label)
+	w.page.Text(margin+110, w.y, 10, false, value)
+	w.y -= 14
+}
+
+func (w *writer) gap(height float64) {
+	w.y -= height
+}
+
+func (w *writer) table(columns []column) {
+	w.space(3 * lineHeight)
+	w.columns = columns
+	w.tableHeader()
+}
+
+func (w *writer) tableHeader() {
+	for _, col := range w.columns {
+		if col.right {
+			w.page.TextRight(col.x+col.width, w.y, 10, true, col.title)
+		} else {
+			w.page.Text(col.x, w.y, 10, true, col.title)
+		}
+	}
+	w.y -= 6
+	w.page.Line(margin, w.y, pdf.PageWidth-margin, w.y, 0.5)
+	w.y -= lineHeight
+}
+
+func (w *writer) row(values ...string) {
+	w.space(lineHeight)
+	for i, col := range w.columns {
+		value := pdf.Truncate(values[i], col.width, 10, false)
+		if col.right {
+			w.page.TextRight(col.x+col.width, w.y, 10, false, value)
+		} else {
+			w.page.Text(col.x, w.y, 10, false, value)
+		}
+	}
+	w.y -= lineHeight
+}
+
+// endTable draws the rule under a table and stops repeating its header.
+func (w *writer) endTable() {
+	w.columns = nil
+	w.y += lineHeight - 6
+	w.page.Line(margin, w.y, pdf.PageWidth-margin, w.y, 0.5)
+	w.y -= lineHeight + 4
+}
+
+// total writes a right-aligned label and amount under a table.
+func (w *writer) total(label, amount string, bold bool) {
+	w.space(lineHeight)
+	right := pdf.PageWidth - margin
+	w.page.TextRight(right-90, w.y, 10, bold, label)
+	w.page.TextRight(right, w.y, 10, bold, amount)
+	w.y -= lineHeight
+}
+
+func (w *writer) bytes() []byte {
+	return w.doc.Bytes()
+}
+
+func money(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func date(t time.Time) string {
+	return t.Format("2 Jan 2006")
+}
+
+// address splits a free-form shipping address into lines on commas and
+// newlines.
+func address(s string) []string {
+	var lines []string
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// load fetches what the documents print: the customer and the items with
+// their products, including products deleted since the order.
+func load(db *gorm.DB, order *models.Order) error {
+	return db.Preload("User").
+		Preload("OrderItems", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Preload("OrderItems.Product", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).
+		First(order, order.ID).Error
+}
+
+func itemName(item models.OrderItem) string {
+	if item.Product.Name != "" {
+		return item.Product.Name
+	}
+	return fmt.Sprintf("Product #%d", item.ProductID)
+}
+
+// Invoice renders the invoice of a paid order.
+func Invoice(db *gorm.DB, order *models.Order) ([]byte, error) {
+	if err := load(db, order); err != nil {
+		return nil, err
+	}
+
+	number := ""
+	if order.InvoiceNumber != nil {
+		number = *order.InvoiceNumber
+	}
+	w := newWriter("Invoice "+number, "INVOICE")
+
+	w.field("Invoice number", number)
+	if order.InvoicedAt != nil {
+		w.field("Invoice date", date(*order.InvoicedAt))
+	}
+	w.field("Order", fmt.Sprintf("#%d, placed %s", order.ID, date(order.CreatedAt)))
+	if order.PaidAt != nil {
+		w.field("Paid", date(*order.PaidAt))
+	}
+	w.gap(10)
+
+	w.text(10, true, "Bill to")
+	w.text(10, false, strings.TrimSpace(order.User.FirstName+" "+order.User.LastName))
+	w.text(10, false, order.User.Email)
+	if lines := address(order.ShippingAddress); len(lines) > 0 {
+		w.gap(6)
+		w.text(10, true, "Ship to")
+		for _, line := range lines {
+			w.text(10, false, line)
+		}
+	}
+	w.gap(14)
+
+	right := pdf.PageWidth - margin
+	w.table([]column{
+		{title: "Item", x: margin, width: 250},
+		{title: "SKU", x: margin + 260, width: 80},
+		{title: "Qty", x: right - 200, width: 40, right: true},
+		{title: "Unit price", x: right - 150, width: 70, right: true},
+		{title: "Amount", x: right - 70, width: 70, right: true},
+	})
+	// Sub-orders cancelled before the order was paid never had a sale
+	// recorded; their items were not charged.
+	var uncharged []uint
+	if err := db.Model(&models.SellerOrder{}).
+		Where("order_id = ? AND status = ?", order.ID, "cancelled").
+		Where("id NOT IN (?)", db.Model(&models.LedgerTransaction{}).
+			Select("seller_order_id").
+			Where("kind = ? AND seller_order_id IS NOT NULL", ledger.KindSale)).
+		Pluck("id", &uncharged).Error; err != nil {
+		return nil, err
+	}
+
+	var subtotal float64
+	for _, item := range order.OrderItems {
+		if item.SellerOrderID != nil && slices.Contains(uncharged, *item.SellerOrderID) {
+			continue
+		}
+		amount := item.Price * float64(item.Quantity)
+		subtotal += amount
+		w.row(itemName(item), item.Product.SKU, fmt.Sprint(item.Quantity), money(item.Price), money(amount))
+	}
+	w.endTable()
+
+	w.total("Subtotal", money(subtotal), false)
+	w.total("Total", money(order.Total), true)
+	if order.Status == "cancelled" {
+		w.gap(10)
+		w.text(10, true, "This order was cancelled and refunded.")
+	}
+	return w.bytes(), nil
+}
+
+// PackingSlip renders the packing slip of an order: what goes in the parcel,
+// where it goes, and which warehouse each item was allocated from. Prices are
+// left off.
+func PackingSlip(db *gorm.DB, order *models.Order) ([]byte, error) {
+	if err := load(db, order); err != nil {
+		return nil, err
+	}
+
+	itemIDs := make([]uint, len(order.OrderItems))
+	for i, item := range order.OrderItems {
+		itemIDs[i] = item.ID
+	}
+	var allocations []struct {
+		OrderItemID uint
+		Code        string
+		Quantity    int
+	}
+	if err := db.Model(&models.StockAllocation{}).
+		Select("stock_allocations.order_item_id, warehouses.code, stock_allocations.quantity").
+		Joins("JOIN warehouses ON warehouses.id = stock_allocations.warehouse_id").
+		Where("stock_allocations.order_item_id IN ?", itemIDs).
+		Order("stock_allocations.id").
+		Scan(&allocations).Error; err != nil {
+		return nil, err
+	}
+	from := make(map[uint][]string)
+	for _, allocation := range allocations {
+		from[allocation.OrderItemID] = append(from[allocation.OrderItemID],
+			fmt.Sprintf("%s x%d", allocation.Code, allocation.Quantity))
+	}
+
+	w := newWriter(fmt.Sprintf("Packing slip for order %d", order.ID), "PACKING SLIP")
+
+	w.field("Order", fmt.Sprintf("#%d", order.ID))
+	w.field("Order date", date(order.CreatedAt))
+	w.field("Status", order.Status)
+	w.gap(10)
+
+	w.text(10, true, "Ship to")
+	w.text(10, false, strings.TrimSpace(order.User.FirstName+" "+order.User.LastName))
+	for _, line := range address(order.ShippingAddress) {
+		w.text(10, false, line)
+	}
+	w.gap(14)
+
+	right := pdf.PageWidth - margin
+	items := 0
+	w.table([]column{
+		{title: "SKU", x: margin, width: 80},
+		{title: "Item", x: margin + 90, width: 220},
+		{title: "Warehouse", x: margin + 320, width: 110},
+		{title: "Qty", x: right - 40, width: 40, right: true},
+	})
+	for _, item := range order.OrderItems {
+		items += item.Quantity
+		w.row(item.Product.SKU, itemName(item), strings.Join(from[item.ID], ", "), fmt.Sprint(item.Quantity))
+	}
+	w.endTable()
+
+	w.total("Items", fmt.Sprint(items), true)
+	return w.bytes(), nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hannanmiah/golang-tutorial/cart"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// GetAbandonedCarts lists abandoned carts for admins, newest first.
+func (h *CartHandler) GetAbandonedCarts(c *gin.Context) {
+	page, perPage := pagination(c)
+
+	query := h.db.Model(&models.AbandonedCart{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var abandoned []models.AbandonedCart
+	if err := query.Order("id desc").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&abandoned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch abandoned carts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"abandoned_carts": abandoned,
+		"page":            page,
+		"per_page":        perPage,
+	})
+}
+
+// GetAbandonedCartStats reports how carts flagged as abandoned in the last
+// ?days= days (default 30) ended.
+func (h *CartHandler) GetAbandonedCartStats(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive number"})
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	stats, err := cart.AbandonedStats(h.db, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute abandoned cart stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since": since,
+		"stats": stats,
+	})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/middleware"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var apiKeys []models.APIKey
+	if err := h.db.Where("user_id = ?", userID).Order("created_at desc").Find(&apiKeys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": apiKeys})
+}
+
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// A key must not be able to mint another key with wider scopes than its own.
+	if _, viaKey := c.Get("api_key_id"); viaKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create other API keys"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !middleware.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope " + scope})
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	key, prefix, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		UserID:    userID.(uint),
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(req.Scopes, ","),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := h.db.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created successfully. Store it now, it will not be shown again.",
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+	var apiKey models.APIKey
+
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+		First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := h.db.Delete(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
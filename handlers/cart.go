@@ -1,19 +1,81 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"github.com/hannanmiah/golang-tutorial/cart"
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/middleware"
 	"github.com/hannanmiah/golang-tutorial/models"
 )
 
 type CartHandler struct {
-	db *gorm.DB
+	db  *gorm.DB
+	cfg *config.Config
 }
 
-func NewCartHandler(db *gorm.DB) *CartHandler {
-	return &CartHandler{db: db}
+func NewCartHandler(db *gorm.DB, cfg *config.Config) *CartHandler {
+	return &CartHandler{db: db, cfg: cfg}
+}
+
+// cartOwner is the signed-in user or the guest a cart belongs to.
+type cartOwner struct {
+	userID  uint
+	guestID string
+}
+
+// scope limits a cart query to the owner's lines.
+func (o cartOwner) scope(db *gorm.DB) *gorm.DB {
+	if o.userID != 0 {
+		return db.Where("user_id = ?", o.userID)
+	}
+	return db.Where("user_id = 0 AND guest_id = ?", o.guestID)
+}
+
+// owner returns whose cart the request is for. A guest without a cart token
+// has no cart yet; with create set one is started and its token returned in
+// the X-Cart-Token response header.
+func (h *CartHandler) owner(c *gin.Context, create bool) (cartOwner, bool) {
+	if userID, exists := c.Get("user_id"); exists {
+		return cartOwner{userID: userID.(uint)}, true
+	}
+	if guestID, exists := c.Get("guest_id"); exists {
+		return cartOwner{guestID: guestID.(string)}, true
+	}
+	if !create {
+		return cartOwner{}, false
+	}
+
+	guestID, token, err := middleware.NewCartToken()
+	if err != nil {
+		return cartOwner{}, false
+	}
+	c.Header(middleware.CartTokenHeader, token)
+	return cartOwner{guestID: guestID}, true
+}
+
+// hold reserves a cart line's stock when reservations start at the cart.
+// Guests hold nothing until their cart is merged into an account.
+func (h *CartHandler) hold(tx *gorm.DB, owner cartOwner, product *models.Product, quantity int) error {
+	if h.cfg.ReservationMode != "cart" || owner.userID == 0 {
+		return nil
+	}
+	_, err := inventory.Reserve(tx, owner.userID, product, quantity, h.cfg.ReservationTTL)
+	return err
+}
+
+// release drops a cart line's hold when reservations start at the cart.
+func (h *CartHandler) release(tx *gorm.DB, owner cartOwner, productID uint) error {
+	if h.cfg.ReservationMode != "cart" || owner.userID == 0 {
+		return nil
+	}
+	return inventory.Release(tx, owner.userID, productID)
 }
 
 type AddToCartRequest struct {
@@ -25,31 +87,89 @@ type UpdateCartRequest struct {
 	Quantity int `json:"quantity" binding:"required,min=1"`
 }
 
+type CartLineRequest struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"gte=0"`
+}
+
+// SetCartRequest sets several cart lines at once. In "replace" mode (the
+// default) the cart ends up holding exactly the given lines; in "patch" mode
+// lines not mentioned are left alone. A quantity of 0 removes the line.
+type SetCartRequest struct {
+	Mode  string            `json:"mode" binding:"omitempty,oneof=replace patch"`
+	Items []CartLineRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// CartLineError explains why one line of a SetCartRequest was rejected.
+type CartLineError struct {
+	Index     int    `json:"index"`
+	ProductID uint   `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Available *int   `json:"available,omitempty"`
+	Error     string `json:"error"`
+}
+
 func (h *CartHandler) GetCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	owner, exists := h.owner(c, false)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		lines, summary := cart.Summarize(h.db, nil, 0)
+		c.JSON(http.StatusOK, gin.H{
+			"cart_items": lines,
+			"summary":    summary,
+		})
 		return
 	}
 
-	var cartItems []models.Cart
-	if err := h.db.Where("user_id = ?", userID).
-		Preload("Product").
-		Find(&cartItems).Error; err != nil {
+	cartItems, err := cart.Load(owner.scope(h.db))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart items"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"cart_items": cartItems})
+	lines, summary := cart.Summarize(h.db, cartItems, owner.userID)
+	c.JSON(http.StatusOK, gin.H{
+		"cart_items": lines,
+		"summary":    summary,
+	})
 }
 
-func (h *CartHandler) AddToCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
+var errProductUnavailable = errors.New("product is not available")
+
+// addItem adds quantity of a product to the owner's cart, on top of what is
+// already there, and reports whether a new line was created. It fails with
+// errProductUnavailable or an *inventory.StockError when the product cannot
+// be bought in that quantity.
+func (h *CartHandler) addItem(tx *gorm.DB, owner cartOwner, product *models.Product, quantity int) (*models.Cart, bool, error) {
+	if product.Status != catalog.StatusPublished {
+		return nil, false, errProductUnavailable
 	}
 
+	var cartItem models.Cart
+	owner.scope(tx).Where("product_id = ?", product.ID).Limit(1).Find(&cartItem)
+	created := cartItem.ID == 0
+	if created {
+		cartItem = models.Cart{
+			UserID:     owner.userID,
+			GuestID:    owner.guestID,
+			ProductID:  product.ID,
+			PriceAtAdd: product.Price,
+		}
+	}
+	cartItem.Quantity += quantity
+
+	if inventory.Available(tx, product, owner.userID) < cartItem.Quantity {
+		return nil, false, &inventory.StockError{ProductID: product.ID, Name: product.Name}
+	}
+	if err := tx.Save(&cartItem).Error; err != nil {
+		return nil, false, err
+	}
+	if err := h.hold(tx, owner, product, cartItem.Quantity); err != nil {
+		return nil, false, err
+	}
+	return &cartItem, created, nil
+}
+
+func (h *CartHandler) AddToCart(c *gin.Context) {
 	var req AddToCartRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -62,50 +182,41 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 		return
 	}
 
-	if product.Stock < req.Quantity {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Insufficient stock for product " + product.Name,
-		})
+	owner, exists := h.owner(c, true)
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start a cart"})
 		return
 	}
 
-	var existingCart models.Cart
-	if err := h.db.Where("user_id = ? AND product_id = ?", userID, req.ProductID).
-		First(&existingCart).Error; err == nil {
-		
-		newQuantity := existingCart.Quantity + req.Quantity
-		if newQuantity > product.Stock {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Insufficient stock for product " + product.Name,
-			})
-			return
-		}
-
-		if err := h.db.Model(&existingCart).Update("quantity", newQuantity).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart item"})
-			return
-		}
-
-		h.db.Preload("Product").First(&existingCart, existingCart.ID)
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "Cart item updated successfully",
-			"cart_item": existingCart,
-		})
+	var cartItem *models.Cart
+	var created bool
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cartItem, created, err = h.addItem(tx, owner, &product, req.Quantity)
+		return err
+	})
+	var stockErr *inventory.StockError
+	if errors.Is(err, errProductUnavailable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product " + product.Name + " is not available"})
 		return
 	}
-
-	cartItem := models.Cart{
-		UserID:    userID.(uint),
-		ProductID: req.ProductID,
-		Quantity:  req.Quantity,
+	if errors.As(err, &stockErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": stockErr.Error()})
+		return
 	}
-
-	if err := h.db.Create(&cartItem).Error; err != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item to cart"})
 		return
 	}
 
-	h.db.Preload("Product").First(&cartItem, cartItem.ID)
+	h.db.Preload("Product").First(cartItem, cartItem.ID)
+	if !created {
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Cart item updated successfully",
+			"cart_item": cartItem,
+		})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{
 		"message":   "Item added to cart successfully",
 		"cart_item": cartItem,
@@ -113,16 +224,16 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 }
 
 func (h *CartHandler) UpdateCartItem(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	owner, exists := h.owner(c, false)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
 
 	id := c.Param("id")
 	var cartItem models.Cart
 
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+	if err := owner.scope(h.db).Where("id = ?", id).
 		First(&cartItem).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
@@ -140,14 +251,24 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 		return
 	}
 
-	if req.Quantity > product.Stock {
+	if product.Status != catalog.StatusPublished {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product " + product.Name + " is not available"})
+		return
+	}
+
+	if req.Quantity > inventory.Available(h.db, &product, owner.userID) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Insufficient stock for product " + product.Name,
 		})
 		return
 	}
 
-	if err := h.db.Model(&cartItem).Update("quantity", req.Quantity).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&cartItem).Update("quantity", req.Quantity).Error; err != nil {
+			return err
+		}
+		return h.hold(tx, owner, &product, req.Quantity)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart item"})
 		return
 	}
@@ -160,22 +281,27 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 }
 
 func (h *CartHandler) RemoveFromCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	owner, exists := h.owner(c, false)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
 
 	id := c.Param("id")
 	var cartItem models.Cart
 
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+	if err := owner.scope(h.db).Where("id = ?", id).
 		First(&cartItem).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
 
-	if err := h.db.Delete(&cartItem).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&cartItem).Error; err != nil {
+			return err
+		}
+		return h.release(tx, owner, cartItem.ProductID)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove item from cart"})
 		return
 	}
@@ -183,17 +309,364 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart successfully"})
 }
 
+var errCartLines = errors.New("invalid cart lines")
+
+// SetCart replaces or patches the whole cart in one request. Every line is
+// checked against the stock available, and either all of them are applied
+// or, if any line is rejected, none.
+func (h *CartHandler) SetCart(c *gin.Context) {
+	var req SetCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, exists := h.owner(c, true)
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start a cart"})
+		return
+	}
+
+	var lineErrors []CartLineError
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		seen := make(map[uint]bool)
+		for i, line := range req.Items {
+			lineError := CartLineError{Index: i, ProductID: line.ProductID, Quantity: line.Quantity}
+			if seen[line.ProductID] {
+				lineError.Error = "Product appears more than once"
+				lineErrors = append(lineErrors, lineError)
+				continue
+			}
+			seen[line.ProductID] = true
+
+			msg, available, err := h.setItem(tx, owner, line.ProductID, line.Quantity)
+			if err != nil {
+				return err
+			}
+			if msg != "" {
+				lineError.Error = msg
+				lineError.Available = available
+				lineErrors = append(lineErrors, lineError)
+			}
+		}
+		if len(lineErrors) > 0 {
+			return errCartLines
+		}
+
+		if req.Mode == "patch" {
+			return nil
+		}
+		var removed []models.Cart
+		query := owner.scope(tx)
+		if len(seen) > 0 {
+			ids := make([]uint, 0, len(seen))
+			for id := range seen {
+				ids = append(ids, id)
+			}
+			query = query.Where("product_id NOT IN ?", ids)
+		}
+		if err := query.Find(&removed).Error; err != nil {
+			return err
+		}
+		for i := range removed {
+			if err := tx.Delete(&removed[i]).Error; err != nil {
+				return err
+			}
+			if err := h.release(tx, owner, removed[i].ProductID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errCartLines) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Some lines could not be applied; the cart was not changed",
+			"errors": lineErrors,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		return
+	}
+
+	cartItems, err := cart.Load(owner.scope(h.db))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart items"})
+		return
+	}
+
+	lines, summary := cart.Summarize(h.db, cartItems, owner.userID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Cart updated successfully",
+		"cart_items": lines,
+		"summary":    summary,
+	})
+}
+
+// setItem sets the quantity of a product in the owner's cart, removing the
+// line at 0. A line that cannot be set is reported by message, with the
+// stock available when that was the reason.
+func (h *CartHandler) setItem(tx *gorm.DB, owner cartOwner, productID uint, quantity int) (string, *int, error) {
+	var cartItem models.Cart
+	owner.scope(tx).Where("product_id = ?", productID).Limit(1).Find(&cartItem)
+
+	if quantity == 0 {
+		if cartItem.ID == 0 {
+			return "", nil, nil
+		}
+		if err := tx.Delete(&cartItem).Error; err != nil {
+			return "", nil, err
+		}
+		return "", nil, h.release(tx, owner, productID)
+	}
+
+	var product models.Product
+	if err := tx.Limit(1).Find(&product, productID).Error; err != nil {
+		return "", nil, err
+	}
+	if product.ID == 0 {
+		return "Product not found", nil, nil
+	}
+	if product.Status != catalog.StatusPublished {
+		return "Product " + product.Name + " is not available", nil, nil
+	}
+
+	available := inventory.Available(tx, &product, owner.userID)
+	if available < quantity {
+		if available < 0 {
+			available = 0
+		}
+		return "Insufficient stock for product " + product.Name, &available, nil
+	}
+
+	if cartItem.ID == 0 {
+		cartItem = models.Cart{
+			UserID:     owner.userID,
+			GuestID:    owner.guestID,
+			ProductID:  product.ID,
+			PriceAtAdd: product.Price,
+		}
+	}
+	cartItem.Quantity = quantity
+	if err := tx.Save(&cartItem).Error; err != nil {
+		return "", nil, err
+	}
+	return "", nil, h.hold(tx, owner, &product, quantity)
+}
+
 func (h *CartHandler) ClearCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	owner, exists := h.owner(c, false)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.JSON(http.StatusOK, gin.H{"message": "Cart cleared successfully"})
 		return
 	}
 
-	if err := h.db.Where("user_id = ?", userID).Delete(&models.Cart{}).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := owner.scope(tx).Delete(&models.Cart{}).Error; err != nil {
+			return err
+		}
+		if owner.userID == 0 {
+			return nil
+		}
+		return inventory.ReleaseAll(tx, owner.userID)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared successfully"})
-}
\ No newline at end of file
+}
+
+type CheckoutItemError struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+var errCheckoutStock = errors.New("insufficient stock")
+
+// Checkout reserves stock for every item in the cart, all or nothing, so it
+// cannot sell out while the shopper pays. The hold is taken over by the order
+// placed from the cart.
+func (h *CartHandler) Checkout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cartItems []models.Cart
+	if err := h.db.Where("user_id = ?", userID).
+		Preload("Product").
+		Find(&cartItems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart items"})
+		return
+	}
+
+	if len(cartItems) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+
+	var reservations []models.Reservation
+	var itemErrors []CheckoutItemError
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for i := range cartItems {
+			item := &cartItems[i]
+			if item.Product.Status != catalog.StatusPublished {
+				itemErrors = append(itemErrors, CheckoutItemError{
+					ProductID: item.ProductID,
+					Name:      item.Product.Name,
+					Requested: item.Quantity,
+				})
+				continue
+			}
+			reservation, err := inventory.Reserve(tx, item.UserID, &item.Product, item.Quantity, h.cfg.ReservationTTL)
+			var stockErr *inventory.StockError
+			if errors.As(err, &stockErr) {
+				available := inventory.Available(tx, &item.Product, item.UserID)
+				if available < 0 {
+					available = 0
+				}
+				itemErrors = append(itemErrors, CheckoutItemError{
+					ProductID: item.ProductID,
+					Name:      item.Product.Name,
+					Requested: item.Quantity,
+					Available: available,
+				})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			reservations = append(reservations, *reservation)
+		}
+		if len(itemErrors) > 0 {
+			return errCheckoutStock
+		}
+		return nil
+	})
+	if errors.Is(err, errCheckoutStock) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Some items are no longer available in the requested quantity",
+			"items": itemErrors,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve cart items"})
+		return
+	}
+
+	var expiresAt time.Time
+	for _, reservation := range reservations {
+		if expiresAt.IsZero() || reservation.ExpiresAt.Before(expiresAt) {
+			expiresAt = reservation.ExpiresAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Cart items reserved",
+		"reservations": reservations,
+		"expires_at":   expiresAt,
+	})
+}
+
+// CartAdjustment describes a line that could not be copied into a cart as it
+// was: its quantity was cut to the stock available, it was dropped, or, on a
+// reorder, its price changed since the order.
+type CartAdjustment struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name"`
+	Requested int    `json:"requested"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+
+	OrderedPrice float64 `json:"ordered_price,omitempty"`
+	Price        float64 `json:"price,omitempty"`
+}
+
+// mergeGuestCart moves a guest's cart into a user's. Lines for a product
+// already in the user's cart are added together, and quantities are capped
+// at the stock available. The returned adjustments list every line that
+// changed on the way.
+func mergeGuestCart(db *gorm.DB, cfg *config.Config, guestID string, userID uint) (int, []CartAdjustment, error) {
+	merged := 0
+	adjustments := []CartAdjustment{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var guestItems []models.Cart
+		if err := tx.Where("user_id = 0 AND guest_id = ?", guestID).
+			Preload("Product").
+			Find(&guestItems).Error; err != nil {
+			return err
+		}
+
+		for _, item := range guestItems {
+			if err := tx.Delete(&item).Error; err != nil {
+				return err
+			}
+
+			if item.Product.ID == 0 || item.Product.Status != catalog.StatusPublished {
+				adjustments = append(adjustments, CartAdjustment{
+					ProductID: item.ProductID,
+					Name:      item.Product.Name,
+					Requested: item.Quantity,
+					Reason:    "unavailable",
+				})
+				continue
+			}
+
+			var existing models.Cart
+			tx.Where("user_id = ? AND product_id = ?", userID, item.ProductID).Limit(1).Find(&existing)
+
+			requested := existing.Quantity + item.Quantity
+			quantity := requested
+			if available := inventory.Available(tx, &item.Product, userID); quantity > available {
+				quantity = available
+			}
+			if quantity < existing.Quantity {
+				quantity = existing.Quantity
+			}
+
+			if quantity != requested {
+				reason := "limited_stock"
+				if quantity == 0 {
+					reason = "out_of_stock"
+				}
+				adjustments = append(adjustments, CartAdjustment{
+					ProductID: item.ProductID,
+					Name:      item.Product.Name,
+					Requested: requested,
+					Quantity:  quantity,
+					Reason:    reason,
+				})
+			}
+			if quantity == 0 || quantity == existing.Quantity {
+				continue
+			}
+
+			if existing.ID != 0 {
+				if err := tx.Model(&existing).Update("quantity", quantity).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Create(&models.Cart{
+				UserID:     userID,
+				ProductID:  item.ProductID,
+				Quantity:   quantity,
+				PriceAtAdd: item.PriceAtAdd,
+			}).Error; err != nil {
+				return err
+			}
+			if cfg.ReservationMode == "cart" {
+				if _, err := inventory.Reserve(tx, userID, &item.Product, quantity, cfg.ReservationTTL); err != nil {
+					return err
+				}
+			}
+			merged++
+		}
+		return nil
+	})
+	return merged, adjustments, err
+}
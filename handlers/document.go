@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/documents"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/orders"
+	"github.com/hannanmiah/golang-tutorial/reports"
+)
+
+func sendPDF(c *gin.Context, filename string, data []byte) {
+	c.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// GetInvoice renders the invoice of one of the caller's orders, or of any
+// order for admins. Orders paid before invoice numbers existed, or moved on
+// without being marked paid before that was enforced, get theirs the first
+// time the invoice is asked for.
+func (h *OrderHandler) GetInvoice(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := h.db.Where("id = ?", c.Param("id"))
+	if role, _ := c.Get("role"); role != "admin" {
+		query = query.Where("user_id = ?", userID)
+	}
+	var order models.Order
+	if err := query.First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.PaidAt == nil && !slices.Contains(reports.PaidStatuses, order.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An invoice is issued once the order is paid"})
+		return
+	}
+
+	if order.InvoiceNumber == nil {
+		if err := h.db.Transaction(func(tx *gorm.DB) error {
+			return orders.AssignInvoiceNumber(tx, &order)
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign an invoice number"})
+			return
+		}
+	}
+
+	data, err := documents.Invoice(h.db, &order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invoice"})
+		return
+	}
+	sendPDF(c, *order.InvoiceNumber+".pdf", data)
+}
+
+// GetPackingSlip renders an order's packing slip for admins.
+func (h *OrderHandler) GetPackingSlip(c *gin.Context) {
+	var order models.Order
+	if err := h.db.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status == "cancelled" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cancelled orders are not shipped"})
+		return
+	}
+
+	data, err := documents.PackingSlip(h.db, &order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate packing slip"})
+		return
+	}
+	sendPDF(c, fmt.Sprintf("packing-slip-%d.pdf", order.ID), data)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
+)
+
+type ExportHandler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	notifier notify.Notifier
+}
+
+func NewExportHandler(db *gorm.DB, cfg *config.Config, notifier notify.Notifier) *ExportHandler {
+	return &ExportHandler{db: db, cfg: cfg, notifier: notifier}
+}
+
+func (h *ExportHandler) CreateExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var running int64
+	h.db.Model(&models.DataExport{}).
+		Where("user_id = ? AND status IN ?", userID, []string{"pending", "processing"}).
+		Count(&running)
+	if running > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export is already in progress"})
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+
+	export := models.DataExport{
+		UserID:    userID.(uint),
+		Status:    "pending",
+		TokenHash: hashToken(token),
+	}
+
+	if err := h.db.Create(&export).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+
+	go h.build(export.ID, token)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export started. You will be notified when it is ready.",
+		"export":  export,
+	})
+}
+
+func (h *ExportHandler) GetExports(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var exports []models.DataExport
+	if err := h.db.Where("user_id = ?", userID).Order("created_at desc").Find(&exports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// DownloadExport serves a finished export to anyone holding its link until
+// the link expires. Expired archives are removed on first access.
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	var export models.DataExport
+	if err := h.db.Where("token = ? AND status = ?", hashToken(c.Param("token")), "ready").
+		First(&export).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	if export.ExpiresAt.Before(time.Now()) {
+		os.Remove(export.FilePath)
+		h.db.Model(&export).Update("status", "expired")
+		c.JSON(http.StatusGone, gin.H{"error": "Download link has expired"})
+		return
+	}
+
+	c.FileAttachment(export.FilePath, fmt.Sprintf("data-export-%d.zip", export.ID))
+}
+
+// FailInterrupted marks exports that were still being built when the server
+// stopped as failed, so their owners can start a new one.
+func (h *ExportHandler) FailInterrupted() error {
+	return h.db.Model(&models.DataExport{}).
+		Where("status IN ?", []string{"pending", "processing"}).
+		Updates(map[string]interface{}{
+			"status": "failed",
+			"error":  "Export was interrupted",
+		}).Error
+}
+
+// SweepExpired removes the archives of exports whose link has expired.
+func (h *ExportHandler) SweepExpired() error {
+	var exports []models.DataExport
+	if err := h.db.Where("status = ? AND expires_at <= ?", "ready", time.Now()).
+		Find(&exports).Error; err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove export %d: %v", export.ID, err)
+			continue
+		}
+		if err := h.db.Model(&export).Update("status", "expired").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build writes the archive and mails the download link. Only the hash of the
+// token is stored, so this is the one place the link can be sent from.
+func (h *ExportHandler) build(exportID uint, token string) {
+	var export models.DataExport
+	if err := h.db.First(&export, exportID).Error; err != nil {
+		log.Printf("Export %d not found: %v", exportID, err)
+		return
+	}
+	h.db.Model(&export).Update("status", "processing")
+
+	var user models.User
+	if err := h.db.First(&user, export.UserID).Error; err != nil {
+		h.fail(&export, err)
+		return
+	}
+
+	path, err := h.writeArchive(export, user)
+	if err != nil {
+		h.fail(&export, err)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(h.cfg.ExportLinkTTL)
+	h.db.Model(&export).Updates(map[string]interface{}{
+		"status":       "ready",
+		"file_path":    path,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	})
+
+	h.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("Download your data until %s: %s",
+			expiresAt.Format(time.RFC1123), fmt.Sprintf("%s/exports/%s", h.cfg.AppURL, token)),
+	})
+}
+
+func (h *ExportHandler) fail(export *models.DataExport, err error) {
+	log.Printf("Export %d failed: %v", export.ID, err)
+	h.db.Model(export).Updates(map[string]interface{}{
+		"status": "failed",
+		"error":  "Failed to build export",
+	})
+}
+
+func (h *ExportHandler) writeArchive(export models.DataExport, user models.User) (string, error) {
+	var orders []models.Order
+	if err := h.db.Where("user_id = ?", user.ID).Preload("OrderItems").Find(&orders).Error; err != nil {
+		return "", err
+	}
+	var cartItems []models.Cart
+	if err := h.db.Where("user_id = ?", user.ID).Find(&cartItems).Error; err != nil {
+		return "", err
+	}
+	var products []models.Product
+	if err := h.db.Where("owner_id = ?", user.ID).Find(&products).Error; err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(h.cfg.ExportDir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(h.cfg.ExportDir, fmt.Sprintf("export-%d.zip", export.ID))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	entries := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", gin.H{
+			"id":            user.ID,
+			"first_name":    user.FirstName,
+			"last_name":     user.LastName,
+			"email":         user.Email,
+			"pending_email": user.PendingEmail,
+			"role":          user.Role,
+			"created_at":    user.CreatedAt,
+			"updated_at":    user.UpdatedAt,
+		}},
+		{"orders.json", orders},
+		{"cart.json", cartItems},
+		{"products.json", products},
+	}
+
+	for _, entry := range entries {
+		w, err := archive.Create(entry.name)
+		if err != nil {
+			return "", err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entry.data); err != nil {
+			return "", err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
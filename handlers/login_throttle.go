@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+const (
+	throttleScopeEmail = "email"
+	throttleScopeIP    = "ip"
+)
+
+// loginThrottle tracks failed logins per email and per client IP. Once a key
+// reaches its attempt limit it is locked, and every further failure doubles
+// the lockout up to the configured maximum.
+type loginThrottle struct {
+	db            *gorm.DB
+	maxAttempts   int
+	ipMaxAttempts int
+	window        time.Duration
+	lockoutBase   time.Duration
+	lockoutMax    time.Duration
+}
+
+func newLoginThrottle(db *gorm.DB, cfg *config.Config) *loginThrottle {
+	return &loginThrottle{
+		db:            db,
+		maxAttempts:   cfg.LoginMaxAttempts,
+		ipMaxAttempts: cfg.LoginIPMaxAttempts,
+		window:        cfg.LoginAttemptWindow,
+		lockoutBase:   cfg.LoginLockoutBase,
+		lockoutMax:    cfg.LoginLockoutMax,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// lockedUntil returns the latest active lock for the given email or IP, if any.
+func (t *loginThrottle) lockedUntil(email, ip string) *time.Time {
+	var throttles []models.LoginThrottle
+	t.db.Where("(scope = ? AND identifier = ?) OR (scope = ? AND identifier = ?)",
+		throttleScopeEmail, normalizeEmail(email), throttleScopeIP, ip).
+		Where("locked_until > ?", time.Now()).
+		Find(&throttles)
+
+	var until *time.Time
+	for _, throttle := range throttles {
+		if until == nil || throttle.LockedUntil.After(*until) {
+			until = throttle.LockedUntil
+		}
+	}
+	return until
+}
+
+func (t *loginThrottle) recordFailure(email, ip string) {
+	t.fail(throttleScopeEmail, normalizeEmail(email), t.maxAttempts)
+	t.fail(throttleScopeIP, ip, t.ipMaxAttempts)
+}
+
+func (t *loginThrottle) fail(scope, identifier string, limit int) {
+	now := time.Now()
+	throttle := models.LoginThrottle{Scope: scope, Identifier: identifier}
+	if err := t.db.Where(&throttle).FirstOrCreate(&throttle).Error; err != nil {
+		log.Printf("Failed to load login throttle for %s %s: %v", scope, identifier, err)
+		return
+	}
+
+	// Count in SQL so concurrent failures cannot overwrite each other, starting
+	// over when the previous failure is outside the window.
+	if err := t.db.Model(&throttle).Updates(map[string]interface{}{
+		"failed_attempts": gorm.Expr("CASE WHEN last_failed_at IS NULL OR last_failed_at >= ? THEN failed_attempts + 1 ELSE 1 END", now.Add(-t.window)),
+		"last_failed_at":  now,
+	}).Error; err != nil {
+		log.Printf("Failed to record login failure for %s %s: %v", scope, identifier, err)
+		return
+	}
+
+	if err := t.db.Select("failed_attempts").First(&throttle, throttle.ID).Error; err != nil {
+		log.Printf("Failed to reload login throttle for %s %s: %v", scope, identifier, err)
+		return
+	}
+	if throttle.FailedAttempts < limit {
+		return
+	}
+	until := now.Add(t.lockoutDuration(throttle.FailedAttempts - limit))
+	if err := t.db.Model(&throttle).Update("locked_until", until).Error; err != nil {
+		log.Printf("Failed to lock %s %s: %v", scope, identifier, err)
+	}
+}
+
+func (t *loginThrottle) lockoutDuration(excess int) time.Duration {
+	if excess > 30 {
+		return t.lockoutMax
+	}
+	duration := time.Duration(float64(t.lockoutBase) * math.Pow(2, float64(excess)))
+	if duration > t.lockoutMax {
+		return t.lockoutMax
+	}
+	return duration
+}
+
+// reset clears the failure counter for an email after a successful login. The
+// IP counter is left alone so a single valid account cannot be used to keep
+// resetting an IP that is guessing passwords for other accounts.
+func (t *loginThrottle) reset(email string) {
+	t.db.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND identifier = ?", throttleScopeEmail, normalizeEmail(email)).
+		Updates(map[string]interface{}{
+			"failed_attempts": 0,
+			"locked_until":    nil,
+		})
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword spends the same bcrypt work as a real password check so
+// response timing does not reveal whether an email is registered.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+func respondLocked(c *gin.Context, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Please try again later.",
+		"retry_after": retryAfter,
+	})
+}
+
+func (h *UserHandler) GetLockouts(c *gin.Context) {
+	query := h.db.Where("locked_until > ?", time.Now())
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	var throttles []models.LoginThrottle
+	if err := query.Order("locked_until desc").Find(&throttles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": throttles})
+}
+
+func (h *UserHandler) Unlock(c *gin.Context) {
+	id := c.Param("id")
+	var throttle models.LoginThrottle
+
+	if err := h.db.First(&throttle, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lockout not found"})
+		return
+	}
+
+	if err := h.db.Model(&throttle).Updates(map[string]interface{}{
+		"failed_attempts": 0,
+		"locked_until":    nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked successfully"})
+}
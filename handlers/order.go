@@ -1,23 +1,34 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/inventory"
 	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/orders"
 )
 
 type OrderHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	cfg   *config.Config
+	carts *CartHandler
 }
 
-func NewOrderHandler(db *gorm.DB) *OrderHandler {
-	return &OrderHandler{db: db}
+func NewOrderHandler(db *gorm.DB, cfg *config.Config) *OrderHandler {
+	return &OrderHandler{db: db, cfg: cfg, carts: NewCartHandler(db, cfg)}
 }
 
 type CreateOrderRequest struct {
 	Items []OrderItemRequest `json:"items" binding:"required,min=1"`
+
+	ShippingAddress   string   `json:"shipping_address"`
+	ShippingLatitude  *float64 `json:"shipping_latitude" binding:"omitempty,gte=-90,lte=90"`
+	ShippingLongitude *float64 `json:"shipping_longitude" binding:"omitempty,gte=-180,lte=180"`
 }
 
 type OrderItemRequest struct {
@@ -35,6 +46,7 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	var orders []models.Order
 	if err := h.db.Where("user_id = ?", userID).
 		Preload("OrderItems.Product").
+		Preload("SellerOrders").
 		Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
@@ -55,6 +67,8 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
 		Preload("OrderItems.Product").
+		Preload("SellerOrders").
+		Preload("Shipments.Items").
 		First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
@@ -86,7 +100,12 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			return
 		}
 
-		if product.Stock < item.Quantity {
+		if product.Status != catalog.StatusPublished {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product " + product.Name + " is not available"})
+			return
+		}
+
+		if inventory.Available(h.db, &product, userID.(uint)) < item.Quantity {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Insufficient stock for product " + product.Name,
 			})
@@ -100,9 +119,8 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			ProductID: item.ProductID,
 			Quantity:  item.Quantity,
 			Price:     product.Price,
+			SellerID:  product.OwnerID,
 		})
-
-		h.db.Model(&product).UpdateColumn("stock", gorm.Expr("stock - ?", item.Quantity))
 	}
 
 	order := models.Order{
@@ -110,14 +128,32 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		Status:     "pending",
 		Total:      total,
 		OrderItems: orderItems,
+
+		ShippingAddress:   req.ShippingAddress,
+		ShippingLatitude:  req.ShippingLatitude,
+		ShippingLongitude: req.ShippingLongitude,
 	}
 
-	if err := h.db.Create(&order).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if err := orders.CreateSellerOrders(tx, &order); err != nil {
+			return err
+		}
+		return inventory.ReserveOrder(tx, &order, h.cfg.OrderPaymentTTL)
+	})
+	var stockErr *inventory.StockError
+	if errors.As(err, &stockErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": stockErr.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
 
-	h.db.Preload("OrderItems.Product").First(&order, order.ID)
+	h.db.Preload("OrderItems.Product").Preload("SellerOrders").First(&order, order.ID)
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Order created successfully",
 		"order":   order,
@@ -140,19 +176,37 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required,oneof=processing shipped delivered cancelled"`
+		Status string `json:"status" binding:"required,oneof=paid processing cancelled"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.db.Model(&order).Update("status", req.Status).Error; err != nil {
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		return orders.SetStatus(tx, &order, &actorID, req.Status)
+	})
+	if errors.Is(err, orders.ErrInvalidTransition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change the status of a " + order.Status + " order"})
+		return
+	}
+	if errors.Is(err, orders.ErrShipped) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot cancel an order with items that have shipped"})
+		return
+	}
+	var stockErr *inventory.StockError
+	if errors.As(err, &stockErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
 		return
 	}
 
-	h.db.Preload("OrderItems.Product").First(&order, id)
+	h.db.Preload("OrderItems.Product").Preload("SellerOrders").First(&order, id)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Order status updated successfully",
 		"order":   order,
@@ -166,13 +220,39 @@ func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 		return
 	}
 
+	query, msg := filterOrders(c, h.db)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	query, msg = sortOrders(c, query)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	page, perPage := pagination(c)
 	var orders []models.Order
-	if err := h.db.Preload("User").
+	if err := query.Preload("User").
 		Preload("OrderItems.Product").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
 		Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"orders": orders})
+	c.JSON(http.StatusOK, gin.H{
+		"orders":   orders,
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+	})
 }
\ No newline at end of file
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// orderSorts maps the sort query parameter to the columns it orders by.
+var orderSorts = map[string]string{
+	"id":         "orders.id",
+	"created_at": "orders.created_at",
+	"paid_at":    "orders.paid_at",
+	"total":      "orders.total",
+	"status":     "orders.status",
+}
+
+// parseDate reads a date (2006-01-02) or a timestamp (RFC 3339). A bare date
+// used as an upper bound covers the whole day.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// filterOrders applies the admin order search filters: status (one or a
+// comma-separated list), from and to on the order date, email (part of the
+// customer's email), product_id, and min_total and max_total. It returns a
+// message when a filter cannot be parsed. The query can be reused, so it can
+// be counted and then fetched.
+func filterOrders(c *gin.Context, db *gorm.DB) (*gorm.DB, string) {
+	query := db.Model(&models.Order{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("orders.status IN ?", strings.Split(status, ","))
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseDate(from, false)
+		if err != nil {
+			return nil, "from must be a date (2006-01-02) or an RFC 3339 timestamp"
+		}
+		query = query.Where("orders.created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseDate(to, true)
+		if err != nil {
+			return nil, "to must be a date (2006-01-02) or an RFC 3339 timestamp"
+		}
+		query = query.Where("orders.created_at <= ?", t)
+	}
+
+	if email := c.Query("email"); email != "" {
+		query = query.Where("orders.user_id IN (?)",
+			db.Unscoped().Model(&models.User{}).
+				Select("id").
+				Where("LOWER(email) LIKE ?", "%"+strings.ToLower(email)+"%"))
+	}
+
+	if productID := c.Query("product_id"); productID != "" {
+		id, err := strconv.ParseUint(productID, 10, 64)
+		if err != nil {
+			return nil, "product_id must be a number"
+		}
+		query = query.Where("orders.id IN (?)",
+			db.Model(&models.OrderItem{}).
+				Select("order_id").
+				Where("product_id = ?", id))
+	}
+
+	for _, bound := range []struct{ param, op string }{{"min_total", ">="}, {"max_total", "<="}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		total, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, bound.param + " must be a number"
+		}
+		query = query.Where("orders.total "+bound.op+" ?", total)
+	}
+
+	return query.Session(&gorm.Session{}), ""
+}
+
+// sortOrders orders by the sort query parameter, a column name optionally
+// prefixed with "-" for descending order. Newest orders come first by
+// default.
+func sortOrders(c *gin.Context, query *gorm.DB) (*gorm.DB, string) {
+	sort := c.DefaultQuery("sort", "-created_at")
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		sort, direction = sort[1:], "DESC"
+	}
+	column, ok := orderSorts[sort]
+	if !ok {
+		return nil, "sort must be one of id, created_at, paid_at, total or status, optionally prefixed with -"
+	}
+	return query.Order(column + " " + direction).Order("orders.id " + direction), ""
+}
+
+// ExportOrders streams the orders matching the admin search filters as CSV.
+// Rows are read from the database one at a time, so exports of any size use
+// little memory.
+func (h *OrderHandler) ExportOrders(c *gin.Context) {
+	query, msg := filterOrders(c, h.db)
+	if msg == "" {
+		query, msg = sortOrders(c, query)
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	rows, err := query.
+		Select("orders.id, orders.created_at, orders.status, orders.user_id, users.email, " +
+			"(SELECT COALESCE(SUM(quantity), 0) FROM order_items WHERE order_items.order_id = orders.id AND order_items.deleted_at IS NULL) AS items, " +
+			"orders.total, orders.paid_at, orders.invoice_number, orders.shipping_address").
+		Joins("LEFT JOIN users ON users.id = orders.user_id").
+		Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export orders"})
+		return
+	}
+	defer rows.Close()
+
+	filename := "orders-" + time.Now().UTC().Format("20060102") + ".csv"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "status", "user_id", "email", "items", "total", "paid_at", "invoice_number", "shipping_address"})
+
+	count := 0
+	for rows.Next() {
+		var row struct {
+			ID              uint
+			CreatedAt       time.Time
+			Status          string
+			UserID          uint
+			Email           *string
+			Items           int
+			Total           float64
+			PaidAt          *time.Time
+			InvoiceNumber   *string
+			ShippingAddress string
+		}
+		if err := h.db.ScanRows(rows, &row); err != nil {
+			abortExport(c, err)
+			return
+		}
+
+		record := []string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			row.CreatedAt.UTC().Format(time.RFC3339),
+			catalog.CSVCell(row.Status),
+			strconv.FormatUint(uint64(row.UserID), 10),
+			"",
+			strconv.Itoa(row.Items),
+			fmt.Sprintf("%.2f", row.Total),
+			"",
+			"",
+			catalog.CSVCell(row.ShippingAddress),
+		}
+		if row.Email != nil {
+			record[4] = catalog.CSVCell(*row.Email)
+		}
+		if row.PaidAt != nil {
+			record[7] = row.PaidAt.UTC().Format(time.RFC3339)
+		}
+		if row.InvoiceNumber != nil {
+			record[8] = catalog.CSVCell(*row.InvoiceNumber)
+		}
+		w.Write(record)
+
+		count++
+		if count%500 == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(c, err)
+		return
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Failed to write order export: %v", err)
+	}
+}
+
+// abortExport stops an export that failed part way. Before anything is sent
+// the client gets an error response; after that the connection is closed
+// without finishing the body, so the client sees a failed download rather
+// than a truncated file that looks complete.
+func abortExport(c *gin.Context, err error) {
+	log.Printf("Failed to write order export: %v", err)
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		c.Writer.Header().Del("Content-Type")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export orders"})
+		return
+	}
+
+	// gin refuses to hijack once the response has started, so go to the
+	// underlying writer.
+	if w, ok := c.Writer.(interface{ Unwrap() http.ResponseWriter }); ok {
+		if conn, _, err := http.NewResponseController(w.Unwrap()).Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+	c.Abort()
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPerPage = 100
+
+// pagination reads the page and per_page query parameters, defaulting to the
+// first page of 20 results.
+func pagination(c *gin.Context) (page, perPage int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err = strconv.Atoi(c.Query("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 20
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+type PriceHandler struct {
+	db *gorm.DB
+}
+
+func NewPriceHandler(db *gorm.DB) *PriceHandler {
+	return &PriceHandler{db: db}
+}
+
+type CreatePriceScheduleRequest struct {
+	Price    float64    `json:"price" binding:"required,gt=0"`
+	StartsAt time.Time  `json:"starts_at" binding:"required"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// managedProduct loads the product in the route and checks that the caller
+// owns it or is an admin.
+func (h *PriceHandler) managedProduct(c *gin.Context) (*models.Product, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var product models.Product
+	if err := h.db.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+
+	role, _ := c.Get("role")
+	if product.OwnerID != userID.(uint) && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to manage prices of this product"})
+		return nil, false
+	}
+	return &product, true
+}
+
+// GetPriceHistory lists the price changes of any product the caller can see,
+// newest first.
+func (h *PriceHandler) GetPriceHistory(c *gin.Context) {
+	var product models.Product
+	if err := h.db.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	if product.Status != catalog.StatusPublished && product.OwnerID != userID && role != "admin" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	page, perPage := pagination(c)
+
+	var changes []models.PriceChange
+	if err := h.db.Where("product_id = ?", product.ID).
+		Order("id desc").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"price":            product.Price,
+		"compare_at_price": product.CompareAtPrice,
+		"sale_ends_at":     product.SaleEndsAt,
+		"changes":          changes,
+		"page":             page,
+		"per_page":         perPage,
+	})
+}
+
+func (h *PriceHandler) GetPriceSchedules(c *gin.Context) {
+	product, ok := h.managedProduct(c)
+	if !ok {
+		return
+	}
+
+	query := h.db.Where("product_id = ?", product.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var schedules []models.ScheduledPrice
+	if err := query.Order("starts_at").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// CreatePriceSchedule schedules a new price for a product. With ends_at it
+// is a sale: the current price is shown as compare_at_price while it runs and
+// comes back when it ends.
+func (h *PriceHandler) CreatePriceSchedule(c *gin.Context) {
+	product, ok := h.managedProduct(c)
+	if !ok {
+		return
+	}
+
+	var req CreatePriceScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.StartsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at must be in the future"})
+		return
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	if err := catalog.CheckSchedule(h.db, product.ID, req.StartsAt, req.EndsAt); err != nil {
+		if errors.Is(err, catalog.ErrScheduleOverlap) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another sale is scheduled for that time"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check scheduled prices"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schedule := models.ScheduledPrice{
+		ProductID:   product.ID,
+		Price:       req.Price,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Status:      catalog.SchedulePending,
+		CreatedByID: userID.(uint),
+	}
+	if err := h.db.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Price scheduled successfully",
+		"schedule": schedule,
+	})
+}
+
+// CancelPriceSchedule cancels a pending scheduled price. Cancelling a sale
+// that is running ends it now and restores the regular price.
+func (h *PriceHandler) CancelPriceSchedule(c *gin.Context) {
+	product, ok := h.managedProduct(c)
+	if !ok {
+		return
+	}
+
+	var schedule models.ScheduledPrice
+	if err := h.db.Where("id = ? AND product_id = ?", c.Param("scheduleId"), product.ID).
+		First(&schedule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled price not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+
+	var err error
+	switch schedule.Status {
+	case catalog.SchedulePending:
+		err = h.db.Model(&schedule).Update("status", catalog.ScheduleCancelled).Error
+	case catalog.ScheduleActive:
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			return catalog.EndSale(tx, &schedule, &actorID, catalog.ScheduleCancelled)
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending prices and running sales can be cancelled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled price"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Scheduled price cancelled successfully",
+		"schedule": schedule,
+	})
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/inventory"
 	"github.com/hannanmiah/golang-tutorial/models"
 )
 
@@ -21,6 +24,14 @@ type CreateProductRequest struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price" binding:"required,gt=0"`
 	Stock       int     `json:"stock" binding:"gte=0"`
+	Category    string  `json:"category"`
+	SKU         string  `json:"sku"`
+
+	LowStockThreshold int `json:"low_stock_threshold" binding:"gte=0"`
+
+	Status      string     `json:"status" binding:"omitempty,oneof=draft published"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
 }
 
 type UpdateProductRequest struct {
@@ -28,15 +39,55 @@ type UpdateProductRequest struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price" binding:"omitempty,gt=0"`
 	Stock       int     `json:"stock" binding:"omitempty,gte=0"`
+	Category    string  `json:"category"`
+	SKU         string  `json:"sku"`
+
+	LowStockThreshold *int `json:"low_stock_threshold" binding:"omitempty,gte=0"`
+
+	Status string `json:"status" binding:"omitempty,oneof=draft published archived"`
+}
+
+type ScheduleProductRequest struct {
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+}
+
+// validateSchedule checks that scheduled times are in the future and that a
+// product is not unpublished before it is published.
+func validateSchedule(publishAt, unpublishAt *time.Time) string {
+	now := time.Now()
+	if publishAt != nil && !publishAt.After(now) {
+		return "publish_at must be in the future"
+	}
+	if unpublishAt != nil && !unpublishAt.After(now) {
+		return "unpublish_at must be in the future"
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return "unpublish_at must be after publish_at"
+	}
+	return ""
 }
 
+// GetProducts lists published products, along with the caller's own
+// products in any status. Admins see every product.
 func (h *ProductHandler) GetProducts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	roleName, _ := role.(string)
+	ownerID, _ := userID.(uint)
+
+	query := catalog.Visible(h.db, ownerID, roleName)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
 	var products []models.Product
-	if err := h.db.Preload("Owner").Find(&products).Error; err != nil {
+	if err := query.Preload("Owner").Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
 
+	inventory.FillAvailability(h.db, products)
 	c.JSON(http.StatusOK, gin.H{"products": products})
 }
 
@@ -49,7 +100,26 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"product": product})
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	if product.Status != catalog.StatusPublished && product.OwnerID != userID && role != "admin" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	products := []models.Product{product}
+	inventory.FillAvailability(h.db, products)
+
+	summary, err := inventory.Summary(h.db, &product)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock levels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product":      products[0],
+		"availability": summary,
+	})
 }
 
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
@@ -65,15 +135,55 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if msg := validateSchedule(req.PublishAt, req.UnpublishAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if req.Status == "" {
+		req.Status = catalog.StatusDraft
+	}
+
+	if req.SKU != "" && h.skuTaken(userID.(uint), req.SKU, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a product with this SKU"})
+		return
+	}
+
 	product := models.Product{
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
 		Stock:       req.Stock,
+		Category:    req.Category,
+		SKU:         req.SKU,
 		OwnerID:     userID.(uint),
+
+		LowStockThreshold: req.LowStockThreshold,
+
+		Status:      req.Status,
+		PublishAt:   req.PublishAt,
+		UnpublishAt: req.UnpublishAt,
 	}
 
-	if err := h.db.Create(&product).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := catalog.RecordPrice(tx, &models.PriceChange{
+			ProductID: product.ID,
+			NewPrice:  product.Price,
+			Reason:    catalog.PriceInitial,
+			ActorID:   &product.OwnerID,
+		}); err != nil {
+			return err
+		}
+		return inventory.Record(tx, &models.StockMovement{
+			ProductID: product.ID,
+			Delta:     product.Stock,
+			Type:      inventory.MovementInitial,
+			ActorID:   &product.OwnerID,
+		})
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 		return
 	}
@@ -118,14 +228,55 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	if req.Description != "" {
 		updates["description"] = req.Description
 	}
-	if req.Price != 0 {
-		updates["price"] = req.Price
+	if req.Price != 0 && req.Price != product.Price && product.CompareAtPrice != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is on sale; cancel the sale before changing its price"})
+		return
+	}
+	if req.Stock != 0 && inventory.HasStockLevels(h.db, product.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock is managed per warehouse; use the stock adjustment endpoint"})
+		return
+	}
+	if req.Category != "" {
+		updates["category"] = req.Category
 	}
-	if req.Stock != 0 {
-		updates["stock"] = req.Stock
+	if req.SKU != "" {
+		if h.skuTaken(product.OwnerID, req.SKU, product.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This owner already has a product with this SKU"})
+			return
+		}
+		updates["sku"] = req.SKU
+	}
+	if req.LowStockThreshold != nil {
+		updates["low_stock_threshold"] = *req.LowStockThreshold
+	}
+	if req.Status != "" {
+		updates["status"] = req.Status
 	}
 
-	if err := h.db.Model(&product).Updates(updates).Error; err != nil {
+	actorID := userID.(uint)
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if req.Stock != 0 {
+			if err := inventory.SetStock(tx, &product, req.Stock, models.StockMovement{
+				Type:    inventory.MovementAdjustment,
+				Reason:  "product_update",
+				ActorID: &actorID,
+			}); err != nil {
+				return err
+			}
+		}
+		if req.Price != 0 {
+			if err := catalog.SetPrice(tx, &product, req.Price, models.PriceChange{
+				Reason:  catalog.PriceManual,
+				ActorID: &actorID,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&product).Updates(updates).Error
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
@@ -158,6 +309,25 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
+	var ordered int64
+	h.db.Model(&models.OrderItem{}).Where("product_id = ?", product.ID).Count(&ordered)
+	if ordered > 0 {
+		if err := h.db.Model(&product).Updates(map[string]interface{}{
+			"status":       catalog.StatusArchived,
+			"publish_at":   nil,
+			"unpublish_at": nil,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to archive product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Product has orders, so it was archived instead of deleted",
+			"product": product,
+		})
+		return
+	}
+
 	if err := h.db.Delete(&product).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
@@ -173,11 +343,145 @@ func (h *ProductHandler) GetMyProducts(c *gin.Context) {
 		return
 	}
 
+	query := h.db.Where("owner_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
 	var products []models.Product
-	if err := h.db.Where("owner_id = ?", userID).Find(&products).Error; err != nil {
+	if err := query.Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
 
+	inventory.FillAvailability(h.db, products)
 	c.JSON(http.StatusOK, gin.H{"products": products})
+}
+
+// NotifyMe subscribes the caller to an email when an out-of-stock product is
+// available again.
+func (h *ProductHandler) NotifyMe(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var product models.Product
+	if err := h.db.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if product.Status != catalog.StatusPublished {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if product.Stock > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product is in stock"})
+		return
+	}
+
+	subscription := models.StockSubscription{UserID: userID.(uint), ProductID: product.ID}
+	if err := h.db.Where(&subscription).FirstOrCreate(&subscription).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+	if subscription.NotifiedAt != nil {
+		if err := h.db.Model(&subscription).Update("notified_at", nil).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "You will be notified when the product is back in stock",
+		"subscription": subscription,
+	})
+}
+
+func (h *ProductHandler) CancelNotifyMe(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := h.db.Unscoped().
+		Where("user_id = ? AND product_id = ?", userID, c.Param("id")).
+		Delete(&models.StockSubscription{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed successfully"})
+}
+
+// skuTaken reports whether an owner already uses a SKU on another product.
+func (h *ProductHandler) skuTaken(ownerID uint, sku string, productID uint) bool {
+	var count int64
+	h.db.Model(&models.Product{}).
+		Where("owner_id = ? AND sku = ? AND id <> ?", ownerID, sku, productID).
+		Count(&count)
+	return count > 0
+}
+
+// ScheduleProduct sets when a product is published and unpublished. Both
+// times are replaced; leave one out to clear it.
+func (h *ProductHandler) ScheduleProduct(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+	var product models.Product
+
+	if err := h.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	role, _ := c.Get("role")
+	if product.OwnerID != userID.(uint) && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this product"})
+		return
+	}
+
+	if product.Status == catalog.StatusArchived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Archived products cannot be scheduled"})
+		return
+	}
+
+	var req ScheduleProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := validateSchedule(req.PublishAt, req.UnpublishAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := h.db.Model(&product).Updates(map[string]interface{}{
+		"publish_at":   req.PublishAt,
+		"unpublish_at": req.UnpublishAt,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule product"})
+		return
+	}
+
+	h.db.First(&product, id)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Product schedule updated successfully",
+		"product": product,
+	})
 }
\ No newline at end of file
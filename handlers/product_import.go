@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
+)
+
+type ProductImportHandler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	notifier notify.Notifier
+}
+
+func NewProductImportHandler(db *gorm.DB, cfg *config.Config, notifier notify.Notifier) *ProductImportHandler {
+	return &ProductImportHandler{db: db, cfg: cfg, notifier: notifier}
+}
+
+// ImportProducts creates and updates the caller's products from an uploaded
+// CSV file of at most IMPORT_MAX_BYTES. Files with more than
+// IMPORT_ASYNC_ROWS rows are processed in the background and can be followed
+// under /my-products/imports/:id.
+func (h *ProductImportHandler) ImportProducts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(h.cfg.ImportMaxBytes))
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("The file must not be larger than %d bytes", h.cfg.ImportMaxBytes)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required in the \"file\" field"})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", c.PostForm("dry_run")))
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	rows, err := catalog.ParseCSV(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV file: " + err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file has no product rows"})
+		return
+	}
+
+	productImport := models.ProductImport{
+		UserID:    userID.(uint),
+		Filename:  header.Filename,
+		Status:    "processing",
+		DryRun:    dryRun,
+		TotalRows: len(rows),
+	}
+	if err := h.db.Create(&productImport).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start import"})
+		return
+	}
+
+	if len(rows) > h.cfg.ImportAsyncRows {
+		// The goroutine works on its own copy so the response below doesn't race with it.
+		background := productImport
+		go h.run(&background, rows, true)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Import started. You will be notified when it is done.",
+			"import":  productImport,
+		})
+		return
+	}
+
+	h.run(&productImport, rows, false)
+	if productImport.Status == "failed" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+		return
+	}
+
+	message := "Import completed"
+	if dryRun {
+		message = "Dry run completed; no products were changed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"import":  productImport,
+	})
+}
+
+func (h *ProductImportHandler) run(productImport *models.ProductImport, rows []catalog.Row, notifyUser bool) {
+	result, err := catalog.Import(h.db, productImport.UserID, rows, productImport.DryRun)
+
+	now := time.Now()
+	productImport.Status = "completed"
+	productImport.Created = result.Created
+	productImport.Updated = result.Updated
+	productImport.Failed = result.Failed
+	productImport.Rows = result.Rows
+	productImport.CompletedAt = &now
+	if err != nil {
+		log.Printf("Product import %d failed: %v", productImport.ID, err)
+		productImport.Status = "failed"
+		productImport.Error = "Import could not be completed"
+	}
+	if err := h.db.Save(productImport).Error; err != nil {
+		log.Printf("Failed to save product import %d: %v", productImport.ID, err)
+	}
+
+	if !notifyUser {
+		return
+	}
+	var user models.User
+	if err := h.db.First(&user, productImport.UserID).Error; err != nil {
+		return
+	}
+	h.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your product import has finished",
+		Body: fmt.Sprintf("%s: %d created, %d updated, %d failed.",
+			productImport.Filename, productImport.Created, productImport.Updated, productImport.Failed),
+	})
+}
+
+// FailInterrupted marks imports that were still running when the server
+// stopped as failed, so their owners know to upload the file again.
+func (h *ProductImportHandler) FailInterrupted() error {
+	return h.db.Model(&models.ProductImport{}).
+		Where("status = ?", "processing").
+		Updates(map[string]interface{}{
+			"status": "failed",
+			"error":  "Import was interrupted",
+		}).Error
+}
+
+func (h *ProductImportHandler) GetImports(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var imports []models.ProductImport
+	if err := h.db.Omit("rows").
+		Where("user_id = ?", userID).
+		Order("created_at desc").
+		Find(&imports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch imports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imports": imports})
+}
+
+func (h *ProductImportHandler) GetImport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var productImport models.ProductImport
+	if err := h.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&productImport).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"import": productImport})
+}
+
+// ExportProducts downloads the caller's products as CSV or JSON in the format
+// ImportProducts reads.
+func (h *ProductImportHandler) ExportProducts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+		return
+	}
+
+	var products []models.Product
+	if err := h.db.Where("owner_id = ?", userID).Order("id").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	filename := "products-" + time.Now().UTC().Format("20060102") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		records := make([]catalog.Record, len(products))
+		for i := range products {
+			records[i] = catalog.NewRecord(&products[i])
+		}
+		c.JSON(http.StatusOK, records)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	if err := catalog.WriteCSV(c.Writer, products); err != nil {
+		log.Printf("Failed to write product export: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/cart"
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Reorder copies a past order's items into the caller's cart at today's
+// prices. Products that are gone are skipped and quantities are capped at the
+// stock available, on top of whatever the cart already holds. Every line that
+// was not copied as ordered, or whose price changed, is listed in
+// adjustments.
+func (h *OrderHandler) Reorder(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	owner := cartOwner{userID: userID.(uint)}
+
+	var order models.Order
+	if err := h.db.Where("id = ? AND user_id = ?", c.Param("id"), owner.userID).
+		Preload("OrderItems", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	// An order can list a product more than once; reorder it as one line.
+	var productIDs []uint
+	ordered := make(map[uint]models.OrderItem)
+	for _, item := range order.OrderItems {
+		if line, ok := ordered[item.ProductID]; ok {
+			line.Quantity += item.Quantity
+			ordered[item.ProductID] = line
+			continue
+		}
+		productIDs = append(productIDs, item.ProductID)
+		ordered[item.ProductID] = item
+	}
+
+	added := 0
+	adjustments := []CartAdjustment{}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for _, productID := range productIDs {
+			item := ordered[productID]
+			adjustment := CartAdjustment{
+				ProductID:    productID,
+				Requested:    item.Quantity,
+				OrderedPrice: item.Price,
+			}
+
+			var product models.Product
+			tx.Unscoped().Limit(1).Find(&product, productID)
+			adjustment.Name = product.Name
+			if product.ID == 0 || product.DeletedAt.Valid || product.Status != catalog.StatusPublished {
+				adjustment.Reason = "unavailable"
+				adjustments = append(adjustments, adjustment)
+				continue
+			}
+			adjustment.Price = product.Price
+
+			var existing models.Cart
+			owner.scope(tx).Where("product_id = ?", productID).Limit(1).Find(&existing)
+
+			quantity := item.Quantity
+			if available := inventory.Available(tx, &product, owner.userID) - existing.Quantity; quantity > available {
+				quantity = available
+			}
+			if quantity < 0 {
+				quantity = 0
+			}
+			adjustment.Quantity = quantity
+
+			switch {
+			case quantity == 0:
+				adjustment.Reason = "out_of_stock"
+			case quantity < item.Quantity:
+				adjustment.Reason = "limited_stock"
+			case product.Price != item.Price:
+				adjustment.Reason = "price_changed"
+			}
+			if adjustment.Reason != "" {
+				adjustments = append(adjustments, adjustment)
+			}
+			if quantity == 0 {
+				continue
+			}
+
+			if _, _, err := h.carts.addItem(tx, owner, &product, quantity); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add order items to cart"})
+		return
+	}
+
+	if added == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "None of the items in this order can be bought right now",
+			"adjustments": adjustments,
+		})
+		return
+	}
+
+	cartItems, err := cart.Load(owner.scope(h.db))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart items"})
+		return
+	}
+
+	lines, summary := cart.Summarize(h.db, cartItems, owner.userID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Order items added to cart",
+		"added":       added,
+		"adjustments": adjustments,
+		"cart_items":  lines,
+		"summary":     summary,
+	})
+}
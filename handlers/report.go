@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/reports"
+)
+
+type ReportHandler struct {
+	db *gorm.DB
+}
+
+func NewReportHandler(db *gorm.DB) *ReportHandler {
+	return &ReportHandler{db: db}
+}
+
+// maxReportDays is the longest range a report covers, so one request cannot
+// make the server compute years of daily figures.
+const maxReportDays = 366
+
+// reportRange reads the from and to dates of a report, both included. It
+// defaults to the last 30 days and allows at most maxReportDays. The
+// returned end is the midnight after to, ready for half-open range queries.
+func reportRange(c *gin.Context) (from, to time.Time, msg string) {
+	to = reports.Midnight(time.Now())
+	if value := c.Query("to"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return from, to, "to must be a date (2006-01-02)"
+		}
+		to = t
+	}
+	from = to.AddDate(0, 0, -29)
+	if value := c.Query("from"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return from, to, "from must be a date (2006-01-02)"
+		}
+		from = t
+	}
+	if from.After(to) {
+		return from, to, "from must not be after to"
+	}
+	if !to.Before(from.AddDate(0, 0, maxReportDays)) {
+		return from, to, "the range must not be longer than " + strconv.Itoa(maxReportDays) + " days"
+	}
+	return from, to.AddDate(0, 0, 1), ""
+}
+
+func rangeJSON(from, to time.Time) gin.H {
+	return gin.H{
+		"from": from.Format("2006-01-02"),
+		"to":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+	}
+}
+
+// GetRevenue reports revenue, orders, items and average order value per
+// ?group=day (default), week or month, with totals for the whole range.
+func (h *ReportHandler) GetRevenue(c *gin.Context) {
+	from, to, msg := reportRange(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	group := c.DefaultQuery("group", "day")
+	if group != "day" && group != "week" && group != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group must be day, week or month"})
+		return
+	}
+
+	days, err := reports.Daily(h.db, from, to.AddDate(0, 0, -1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute revenue"})
+		return
+	}
+
+	buckets, total := reports.Group(days, group)
+	c.JSON(http.StatusOK, gin.H{
+		"range":   rangeJSON(from, to),
+		"group":   group,
+		"revenue": buckets,
+		"total":   total,
+	})
+}
+
+// GetOrdersByStatus counts the orders placed in the range by status.
+func (h *ReportHandler) GetOrdersByStatus(c *gin.Context) {
+	from, to, msg := reportRange(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	counts, err := reports.OrdersByStatus(h.db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"range":    rangeJSON(from, to),
+		"statuses": counts,
+	})
+}
+
+// GetTopProducts lists the best-selling products, ranked by ?by=quantity
+// (default) or revenue, at most ?limit= (default 10).
+func (h *ReportHandler) GetTopProducts(c *gin.Context) {
+	from, to, msg := reportRange(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	by := c.DefaultQuery("by", "quantity")
+	if by != "quantity" && by != "revenue" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be quantity or revenue"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxPerPage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	products, err := reports.TopProducts(h.db, from, to, by, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rank products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"range":    rangeJSON(from, to),
+		"by":       by,
+		"products": products,
+	})
+}
+
+// GetCustomers reports how many paying customers in the range were new and
+// how many had bought before.
+func (h *ReportHandler) GetCustomers(c *gin.Context) {
+	from, to, msg := reportRange(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	customers, err := reports.NewAndReturning(h.db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count customers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"range":     rangeJSON(from, to),
+		"customers": customers,
+	})
+}
+
+// GetSellerRevenue reports each seller's revenue in the range, highest first.
+func (h *ReportHandler) GetSellerRevenue(c *gin.Context) {
+	from, to, msg := reportRange(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	sellers, err := reports.SellerRevenue(h.db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute seller revenue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"range":   rangeJSON(from, to),
+		"sellers": sellers,
+	})
+}
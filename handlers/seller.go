@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/ledger"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/orders"
+)
+
+type SellerHandler struct {
+	db *gorm.DB
+}
+
+func NewSellerHandler(db *gorm.DB) *SellerHandler {
+	return &SellerHandler{db: db}
+}
+
+type SellerProfileRequest struct {
+	StoreName    string `json:"store_name" binding:"required"`
+	Description  string `json:"description"`
+	ContactEmail string `json:"contact_email" binding:"omitempty,email"`
+}
+
+type UpdateSellerOrderStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=processing cancelled"`
+}
+
+func (h *SellerHandler) GetStorefront(c *gin.Context) {
+	id := c.Param("id")
+	var profile models.SellerProfile
+
+	if err := h.db.Where("user_id = ?", id).First(&profile).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seller not found"})
+		return
+	}
+
+	var products []models.Product
+	if err := h.db.Where("owner_id = ? AND status = ?", profile.UserID, catalog.StatusPublished).
+		Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"seller":   profile,
+		"products": products,
+	})
+}
+
+func (h *SellerHandler) GetSellerProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var profile models.SellerProfile
+	if err := h.db.Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seller profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"seller": profile})
+}
+
+// SaveSellerProfile creates the caller's seller profile, turning their
+// products into a storefront, or updates it if it already exists.
+func (h *SellerHandler) SaveSellerProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req SellerProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var profile models.SellerProfile
+	if err := h.db.Where("user_id = ?", userID).First(&profile).Error; err == nil {
+		if err := h.db.Model(&profile).Updates(map[string]interface{}{
+			"store_name":    req.StoreName,
+			"description":   req.Description,
+			"contact_email": req.ContactEmail,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update seller profile"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Seller profile updated successfully",
+			"seller":  profile,
+		})
+		return
+	}
+
+	profile = models.SellerProfile{
+		UserID:       userID.(uint),
+		StoreName:    req.StoreName,
+		Description:  req.Description,
+		ContactEmail: req.ContactEmail,
+	}
+
+	if err := h.db.Create(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create seller profile"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Seller profile created successfully",
+		"seller":  profile,
+	})
+}
+
+func (h *SellerHandler) GetSellerOrders(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := h.db.Where("seller_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var sellerOrders []models.SellerOrder
+	if err := query.Preload("Order").
+		Preload("OrderItems.Product").
+		Order("created_at desc").
+		Find(&sellerOrders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": sellerOrders})
+}
+
+func (h *SellerHandler) GetSellerOrder(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+	var sellerOrder models.SellerOrder
+
+	if err := h.db.Where("id = ? AND seller_id = ?", id, userID).
+		Preload("Order").
+		Preload("OrderItems.Product").
+		Preload("Shipments.Items").
+		First(&sellerOrder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": sellerOrder})
+}
+
+func (h *SellerHandler) UpdateSellerOrderStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+	var sellerOrder models.SellerOrder
+
+	if err := h.db.Where("id = ? AND seller_id = ?", id, userID).
+		First(&sellerOrder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var req UpdateSellerOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actorID := userID.(uint)
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		return orders.SetSellerOrderStatus(tx, &sellerOrder, &actorID, req.Status)
+	})
+	if errors.Is(err, orders.ErrInvalidTransition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change the status of a " + sellerOrder.Status + " order"})
+		return
+	}
+	if errors.Is(err, orders.ErrShipped) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot cancel an order with items that have shipped"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		return
+	}
+
+	h.db.Preload("Order").Preload("OrderItems.Product").First(&sellerOrder, id)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order status updated successfully",
+		"order":   sellerOrder,
+	})
+}
+
+type CommissionRateRequest struct {
+	SellerID *uint   `json:"seller_id"`
+	Category string  `json:"category"`
+	Percent  float64 `json:"percent" binding:"gte=0,lte=100"`
+}
+
+func (h *SellerHandler) GetBalance(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	summary, err := ledger.Summary(h.db, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balance": summary})
+}
+
+func (h *SellerHandler) GetLedger(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, perPage := pagination(c)
+
+	var entries []struct {
+		ID            uint      `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		TransactionID uint      `json:"transaction_id"`
+		Kind          string    `json:"kind"`
+		OrderID       *uint     `json:"order_id"`
+		PayoutID      *uint     `json:"payout_id"`
+		Memo          string    `json:"memo"`
+		Debit         float64   `json:"debit"`
+		Credit        float64   `json:"credit"`
+	}
+	if err := h.db.Model(&models.LedgerEntry{}).
+		Select("ledger_entries.id, ledger_entries.created_at, ledger_entries.transaction_id, "+
+			"ledger_transactions.kind, ledger_transactions.order_id, ledger_transactions.payout_id, "+
+			"ledger_transactions.memo, ledger_entries.debit, ledger_entries.credit").
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_entries.account = ? AND ledger_entries.seller_id = ?", ledger.AccountSellerPayable, userID).
+		Order("ledger_entries.id desc").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Scan(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":  entries,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+func (h *SellerHandler) GetCommissionRates(c *gin.Context) {
+	var rates []models.CommissionRate
+	if err := h.db.Order("seller_id, category").Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commission rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"commission_rates": rates})
+}
+
+func (h *SellerHandler) CreateCommissionRate(c *gin.Context) {
+	var req CommissionRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.SellerID == nil && req.Category == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A seller_id or category is required"})
+		return
+	}
+
+	rate := models.CommissionRate{
+		SellerID: req.SellerID,
+		Category: req.Category,
+		Percent:  req.Percent,
+	}
+
+	if err := h.db.Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create commission rate"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Commission rate created successfully",
+		"commission_rate": rate,
+	})
+}
+
+func (h *SellerHandler) DeleteCommissionRate(c *gin.Context) {
+	id := c.Param("id")
+	var rate models.CommissionRate
+
+	if err := h.db.First(&rate, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commission rate not found"})
+		return
+	}
+
+	if err := h.db.Delete(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete commission rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Commission rate deleted successfully"})
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
+	"github.com/hannanmiah/golang-tutorial/orders"
+)
+
+type ShipmentHandler struct {
+	db       *gorm.DB
+	notifier notify.Notifier
+}
+
+func NewShipmentHandler(db *gorm.DB, notifier notify.Notifier) *ShipmentHandler {
+	return &ShipmentHandler{db: db, notifier: notifier}
+}
+
+type ShipmentItemRequest struct {
+	OrderItemID uint `json:"order_item_id" binding:"required"`
+	Quantity    int  `json:"quantity" binding:"required,min=1"`
+}
+
+// CreateShipmentRequest records a parcel. Without items, everything not yet
+// shipped goes out in it.
+type CreateShipmentRequest struct {
+	Carrier        string                `json:"carrier" binding:"required"`
+	TrackingNumber string                `json:"tracking_number" binding:"required"`
+	Items          []ShipmentItemRequest `json:"items" binding:"dive"`
+
+	// SellerOrderID picks the seller whose items an admin is shipping when
+	// the order has several and no items are given.
+	SellerOrderID uint `json:"seller_order_id"`
+}
+
+type UpdateShipmentStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=in_transit delivered"`
+}
+
+// GetOrderShipments lists the shipments of one of the caller's orders with
+// their tracking numbers.
+func (h *ShipmentHandler) GetOrderShipments(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var shipments []models.Shipment
+	if err := h.db.Where("order_id = ?", order.ID).
+		Preload("Items").
+		Order("id").
+		Find(&shipments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shipments": shipments})
+}
+
+// CreateSellerShipment ships items of one of the seller's own sub-orders.
+func (h *ShipmentHandler) CreateSellerShipment(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req CreateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sellerOrder models.SellerOrder
+	if err := h.db.Where("id = ? AND seller_id = ?", c.Param("id"), userID).
+		First(&sellerOrder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	h.create(c, &sellerOrder, req, userID.(uint))
+}
+
+// CreateShipment lets admins ship any order. The seller's sub-order is taken
+// from seller_order_id, from the items, or is the order's only one.
+func (h *ShipmentHandler) CreateShipment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req CreateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Preload("OrderItems").Preload("SellerOrders").First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	sellerOrderID := req.SellerOrderID
+	if sellerOrderID == 0 && len(req.Items) > 0 {
+		bySeller := make(map[uint]uint)
+		for _, item := range order.OrderItems {
+			if item.SellerOrderID != nil {
+				bySeller[item.ID] = *item.SellerOrderID
+			}
+		}
+		for _, line := range req.Items {
+			id, ok := bySeller[line.OrderItemID]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Order item %d is not part of this order", line.OrderItemID)})
+				return
+			}
+			if sellerOrderID != 0 && id != sellerOrderID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A shipment can only hold items from one seller"})
+				return
+			}
+			sellerOrderID = id
+		}
+	}
+	if sellerOrderID == 0 && len(order.SellerOrders) == 1 {
+		sellerOrderID = order.SellerOrders[0].ID
+	}
+
+	var sellerOrder *models.SellerOrder
+	for i := range order.SellerOrders {
+		if order.SellerOrders[i].ID == sellerOrderID {
+			sellerOrder = &order.SellerOrders[i]
+		}
+	}
+	if sellerOrder == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose which seller's items to ship with seller_order_id or items"})
+		return
+	}
+
+	h.create(c, sellerOrder, req, userID.(uint))
+}
+
+func (h *ShipmentHandler) create(c *gin.Context, sellerOrder *models.SellerOrder, req CreateShipmentRequest, actorID uint) {
+	lines := make(map[uint]int, len(req.Items))
+	for _, line := range req.Items {
+		lines[line.OrderItemID] += line.Quantity
+	}
+
+	shipment := models.Shipment{
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		CreatedByID:    actorID,
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		return orders.CreateShipment(tx, sellerOrder, &shipment, lines)
+	})
+	var shipmentErr *orders.ShipmentError
+	switch {
+	case errors.Is(err, orders.ErrNotShippable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot ship a " + sellerOrder.Status + " order"})
+		return
+	case errors.Is(err, orders.ErrNothingToShip):
+		c.JSON(http.StatusConflict, gin.H{"error": "Everything in this order has already shipped"})
+		return
+	case errors.As(err, &shipmentErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Order item %d is %s", shipmentErr.OrderItemID, shipmentErr.Message)})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipment"})
+		return
+	}
+
+	h.notifyShipped(&shipment)
+
+	h.db.First(sellerOrder, sellerOrder.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Shipment created successfully",
+		"shipment":     shipment,
+		"order_status": sellerOrder.Status,
+	})
+}
+
+func (h *ShipmentHandler) notifyShipped(shipment *models.Shipment) {
+	var order models.Order
+	if err := h.db.Preload("User").First(&order, shipment.OrderID).Error; err != nil {
+		return
+	}
+	h.notifier.Send(notify.Message{
+		To:      order.User.Email,
+		Subject: fmt.Sprintf("Your order #%d has shipped", order.ID),
+		Body: fmt.Sprintf("A parcel from your order #%d is on its way with %s. Tracking number: %s.",
+			order.ID, shipment.Carrier, shipment.TrackingNumber),
+	})
+}
+
+// UpdateSellerShipmentStatus moves one of the seller's shipments forward.
+func (h *ShipmentHandler) UpdateSellerShipmentStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var shipment models.Shipment
+	if err := h.db.Where("id = ? AND seller_order_id IN (?)", c.Param("id"),
+		h.db.Model(&models.SellerOrder{}).Select("id").Where("seller_id = ?", userID)).
+		First(&shipment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+
+	h.updateStatus(c, &shipment)
+}
+
+// UpdateShipmentStatus moves any shipment forward, for admins.
+func (h *ShipmentHandler) UpdateShipmentStatus(c *gin.Context) {
+	var shipment models.Shipment
+	if err := h.db.First(&shipment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+
+	h.updateStatus(c, &shipment)
+}
+
+func (h *ShipmentHandler) updateStatus(c *gin.Context, shipment *models.Shipment) {
+	var req UpdateShipmentStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := shipment.Status
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		return orders.SetShipmentStatus(tx, shipment, req.Status)
+	})
+	if errors.Is(err, orders.ErrInvalidTransition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change the status of a " + previous + " shipment"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipment status"})
+		return
+	}
+
+	h.db.Preload("Items").First(shipment, shipment.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Shipment status updated successfully",
+		"shipment": shipment,
+	})
+}
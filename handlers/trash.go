@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// TrashHandler lets admins list and restore soft-deleted records.
+type TrashHandler struct {
+	db *gorm.DB
+}
+
+func NewTrashHandler(db *gorm.DB) *TrashHandler {
+	return &TrashHandler{db: db}
+}
+
+func (h *TrashHandler) GetTrashedProducts(c *gin.Context) {
+	page, perPage := pagination(c)
+
+	var products []models.Product
+	if err := h.db.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at desc").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products": products,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+func (h *TrashHandler) RestoreProduct(c *gin.Context) {
+	var product models.Product
+	if err := h.db.Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).
+		First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted product not found"})
+		return
+	}
+
+	var owner models.User
+	if err := h.db.First(&owner, product.OwnerID).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The product's owner is deleted; restore the owner first"})
+		return
+	}
+
+	if product.SKU != "" {
+		var taken int64
+		h.db.Model(&models.Product{}).
+			Where("owner_id = ? AND sku = ?", product.OwnerID, product.SKU).
+			Count(&taken)
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The owner already has another product with this SKU"})
+			return
+		}
+	}
+
+	if err := h.db.Unscoped().Model(&product).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Product restored successfully",
+		"product": product,
+	})
+}
+
+func (h *TrashHandler) GetTrashedUsers(c *gin.Context) {
+	page, perPage := pagination(c)
+
+	var users []models.User
+	if err := h.db.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at desc").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":    users,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+// RestoreUser brings back a soft-deleted user. Accounts their owner deleted
+// were anonymised at the time and cannot be restored.
+func (h *TrashHandler) RestoreUser(c *gin.Context) {
+	var user models.User
+	if err := h.db.Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).
+		First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted user not found"})
+		return
+	}
+
+	if strings.HasSuffix(user.Email, "@deleted.invalid") {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account was anonymised when it was deleted and cannot be restored"})
+		return
+	}
+
+	if err := h.db.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User restored successfully",
+		"user":    user,
+	})
+}
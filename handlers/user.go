@@ -1,22 +1,33 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hannanmiah/golang-tutorial/config"
 	"github.com/hannanmiah/golang-tutorial/middleware"
 	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	cfg      *config.Config
+	notifier notify.Notifier
+	throttle *loginThrottle
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(db *gorm.DB, cfg *config.Config, notifier notify.Notifier) *UserHandler {
+	return &UserHandler{
+		db:       db,
+		cfg:      cfg,
+		notifier: notifier,
+		throttle: newLoginThrottle(db, cfg),
+	}
 }
 
 type RegisterRequest struct {
@@ -63,13 +74,13 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := middleware.GenerateJWT(user.ID, user.Email, user.Role)
+	token, err := middleware.GenerateJWT(user.ID, user.Email, user.Role, user.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"message": "User created successfully",
 		"token":   token,
 		"user": gin.H{
@@ -79,7 +90,11 @@ func (h *UserHandler) Register(c *gin.Context) {
 			"email":      user.Email,
 			"role":       user.Role,
 		},
-	})
+	}
+	if merge := h.mergeCart(c, user.ID); merge != nil {
+		response["cart_merge"] = merge
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 func (h *UserHandler) Login(c *gin.Context) {
@@ -89,24 +104,35 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	clientIP := c.ClientIP()
+	if until := h.throttle.lockedUntil(req.Email, clientIP); until != nil {
+		respondLocked(c, *until)
+		return
+	}
+
 	var user models.User
 	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		compareDummyPassword(req.Password)
+		h.throttle.recordFailure(req.Email, clientIP)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		h.throttle.recordFailure(req.Email, clientIP)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := middleware.GenerateJWT(user.ID, user.Email, user.Role)
+	h.throttle.reset(req.Email)
+
+	token, err := middleware.GenerateJWT(user.ID, user.Email, user.Role, user.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Login successful",
 		"token":   token,
 		"user": gin.H{
@@ -116,7 +142,31 @@ func (h *UserHandler) Login(c *gin.Context) {
 			"email":      user.Email,
 			"role":       user.Role,
 		},
-	})
+	}
+	if merge := h.mergeCart(c, user.ID); merge != nil {
+		response["cart_merge"] = merge
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// mergeCart moves the guest cart of the request's cart token, if any, into
+// the user's cart and reports what was merged. A failed merge leaves the
+// guest cart in place and does not stop the user signing in.
+func (h *UserHandler) mergeCart(c *gin.Context, userID uint) gin.H {
+	guestID, ok := middleware.ParseCartToken(c.GetHeader(middleware.CartTokenHeader))
+	if !ok {
+		return nil
+	}
+
+	merged, adjustments, err := mergeGuestCart(h.db, h.cfg, guestID, userID)
+	if err != nil {
+		log.Printf("Failed to merge guest cart into user %d: %v", userID, err)
+		return nil
+	}
+	return gin.H{
+		"merged":      merged,
+		"adjustments": adjustments,
+	}
 }
 
 func (h *UserHandler) Profile(c *gin.Context) {
@@ -133,12 +183,13 @@ func (h *UserHandler) Profile(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":         user.ID,
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
-		"email":      user.Email,
-		"role":       user.Role,
-		"products":   user.Products,
-		"orders":     user.Orders,
+		"id":            user.ID,
+		"first_name":    user.FirstName,
+		"last_name":     user.LastName,
+		"email":         user.Email,
+		"pending_email": user.PendingEmail,
+		"role":          user.Role,
+		"products":      user.Products,
+		"orders":        user.Orders,
 	})
 }
\ No newline at end of file
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+type WarehouseHandler struct {
+	db *gorm.DB
+}
+
+func NewWarehouseHandler(db *gorm.DB) *WarehouseHandler {
+	return &WarehouseHandler{db: db}
+}
+
+type CreateWarehouseRequest struct {
+	Name      string  `json:"name" binding:"required"`
+	Code      string  `json:"code" binding:"required"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude" binding:"gte=-90,lte=90"`
+	Longitude float64 `json:"longitude" binding:"gte=-180,lte=180"`
+}
+
+type UpdateWarehouseRequest struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	Latitude  *float64 `json:"latitude" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,gte=-180,lte=180"`
+	Active    *bool    `json:"active"`
+}
+
+type AdjustStockRequest struct {
+	WarehouseID uint   `json:"warehouse_id" binding:"required"`
+	Delta       int    `json:"delta" binding:"required"`
+	Reason      string `json:"reason" binding:"required,oneof=received returned damaged lost found correction"`
+	Note        string `json:"note"`
+}
+
+type TransferStockRequest struct {
+	FromWarehouseID uint   `json:"from_warehouse_id"`
+	ToWarehouseID   uint   `json:"to_warehouse_id" binding:"required"`
+	Quantity        int    `json:"quantity" binding:"required,min=1"`
+	Reason          string `json:"reason" binding:"required,oneof=rebalance replenishment correction"`
+	Note            string `json:"note"`
+}
+
+func (h *WarehouseHandler) GetWarehouses(c *gin.Context) {
+	var warehouses []models.Warehouse
+	if err := h.db.Order("code").Find(&warehouses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warehouses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"warehouses": warehouses})
+}
+
+func (h *WarehouseHandler) CreateWarehouse(c *gin.Context) {
+	var req CreateWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing models.Warehouse
+	if err := h.db.Unscoped().Where("code = ?", req.Code).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Warehouse code already in use"})
+		return
+	}
+
+	warehouse := models.Warehouse{
+		Name:      req.Name,
+		Code:      req.Code,
+		Address:   req.Address,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Active:    true,
+	}
+
+	if err := h.db.Create(&warehouse).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create warehouse"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Warehouse created successfully",
+		"warehouse": warehouse,
+	})
+}
+
+func (h *WarehouseHandler) UpdateWarehouse(c *gin.Context) {
+	id := c.Param("id")
+	var warehouse models.Warehouse
+
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+		return
+	}
+
+	var req UpdateWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.Address != "" {
+		updates["address"] = req.Address
+	}
+	if req.Latitude != nil {
+		updates["latitude"] = *req.Latitude
+	}
+	if req.Longitude != nil {
+		updates["longitude"] = *req.Longitude
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+
+	if req.Active != nil && !*req.Active {
+		var held int64
+		h.db.Model(&models.StockLevel{}).Where("warehouse_id = ? AND quantity > 0", warehouse.ID).Count(&held)
+		if held > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Warehouse still holds stock; transfer it out first"})
+			return
+		}
+	}
+
+	if err := h.db.Model(&warehouse).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update warehouse"})
+		return
+	}
+
+	h.db.First(&warehouse, id)
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Warehouse updated successfully",
+		"warehouse": warehouse,
+	})
+}
+
+// DeleteWarehouse removes a warehouse once all of its stock has been
+// transferred out.
+func (h *WarehouseHandler) DeleteWarehouse(c *gin.Context) {
+	id := c.Param("id")
+	var warehouse models.Warehouse
+
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+		return
+	}
+
+	var held int64
+	h.db.Model(&models.StockLevel{}).Where("warehouse_id = ? AND quantity > 0", warehouse.ID).Count(&held)
+	if held > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Warehouse still holds stock; transfer it out first"})
+		return
+	}
+
+	if err := h.db.Delete(&warehouse).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete warehouse"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Warehouse deleted successfully"})
+}
+
+// managedProduct loads the product in the route and checks that the caller
+// owns it or is an admin.
+func (h *WarehouseHandler) managedProduct(c *gin.Context) (*models.Product, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var product models.Product
+	if err := h.db.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+
+	role, _ := c.Get("role")
+	if product.OwnerID != userID.(uint) && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to manage stock of this product"})
+		return nil, false
+	}
+	return &product, true
+}
+
+func (h *WarehouseHandler) warehouseExists(id uint, activeOnly bool) bool {
+	query := h.db.Model(&models.Warehouse{}).Where("id = ?", id)
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	var count int64
+	query.Count(&count)
+	return count > 0
+}
+
+func (h *WarehouseHandler) AdjustStock(c *gin.Context) {
+	product, ok := h.managedProduct(c)
+	if !ok {
+		return
+	}
+
+	var req AdjustStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.warehouseExists(req.WarehouseID, false) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+	entry := models.StockMovement{
+		Type:    inventory.MovementAdjustment,
+		Reason:  req.Reason,
+		Note:    req.Note,
+		ActorID: &actorID,
+	}
+	if req.Reason == "returned" {
+		entry.Type = inventory.MovementReturn
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		_, err := inventory.Adjust(tx, product, req.WarehouseID, req.Delta, entry)
+		return err
+	})
+	if errors.Is(err, inventory.ErrWarehouseStock) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not enough stock in the warehouse"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	summary, _ := inventory.Summary(h.db, product)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Stock adjusted successfully",
+		"stock":   summary,
+	})
+}
+
+func (h *WarehouseHandler) TransferStock(c *gin.Context) {
+	product, ok := h.managedProduct(c)
+	if !ok {
+		return
+	}
+
+	var req TransferStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.FromWarehouseID == req.ToWarehouseID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and destination warehouses must differ"})
+		return
+	}
+	if req.FromWarehouseID != 0 && !h.warehouseExists(req.FromWarehouseID, false) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source warehouse not found"})
+		return
+	}
+	if !h.warehouseExists(req.ToWarehouseID, true) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Destination warehouse not found or inactive"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+	entry := models.StockMovement{
+		Type:    inventory.MovementTransfer,
+		Reason:  req.Reason,
+		Note:    req.Note,
+		ActorID: &actorID,
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		return inventory.Transfer(tx, product, req.FromWarehouseID, req.ToWarehouseID, req.Quantity, entry)
+	})
+	if errors.Is(err, inventory.ErrWarehouseStock) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not enough stock to transfer"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer stock"})
+		return
+	}
+
+	summary, _ := inventory.Summary(h.db, product)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Stock transferred successfully",
+		"stock":   summary,
+	})
+}
+
+// GetStockMovements lists the stock ledger of a product, newest first,
+// optionally filtered by ?type= and ?warehouse_id=.
+func (h *WarehouseHandler) GetStockMovements(c *gin.Context) {
+	product, ok := h.managedProduct(c)
+	if !ok {
+		return
+	}
+
+	page, perPage := pagination(c)
+
+	query := h.db.Where("product_id = ?", product.ID)
+	if movementType := c.Query("type"); movementType != "" {
+		query = query.Where("type = ?", movementType)
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+
+	var movements []models.StockMovement
+	if err := query.Order("id desc").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movements": movements,
+		"stock":     product.Stock,
+		"page":      page,
+		"per_page":  perPage,
+	})
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/catalog"
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// savedForLaterName is the name given to a user's save-for-later list.
+const savedForLaterName = "Saved for later"
+
+type WishlistHandler struct {
+	db    *gorm.DB
+	carts *CartHandler
+}
+
+func NewWishlistHandler(db *gorm.DB, cfg *config.Config) *WishlistHandler {
+	return &WishlistHandler{db: db, carts: NewCartHandler(db, cfg)}
+}
+
+type CreateWishlistRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Shared bool   `json:"shared"`
+}
+
+type UpdateWishlistRequest struct {
+	Name   string `json:"name"`
+	Shared *bool  `json:"shared"`
+}
+
+type AddWishlistItemRequest struct {
+	ProductID uint   `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"omitempty,min=1"`
+	Note      string `json:"note"`
+}
+
+// wishlist loads one of the caller's wishlists from the route.
+func (h *WishlistHandler) wishlist(c *gin.Context) (*models.Wishlist, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var wishlist models.Wishlist
+	if err := h.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&wishlist).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+		return nil, false
+	}
+	return &wishlist, true
+}
+
+// share gives a wishlist a public link, or takes it away.
+func (h *WishlistHandler) share(wishlist *models.Wishlist, shared bool) error {
+	if !shared {
+		wishlist.ShareToken = nil
+		return nil
+	}
+	if wishlist.ShareToken != nil {
+		return nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	wishlist.ShareToken = &token
+	return nil
+}
+
+func (h *WishlistHandler) GetWishlists(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var wishlists []models.Wishlist
+	if err := h.db.Where("user_id = ?", userID).
+		Preload("Items.Product").
+		Order("saved_for_later desc, id").
+		Find(&wishlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wishlists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wishlists": wishlists})
+}
+
+func (h *WishlistHandler) CreateWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req CreateWishlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wishlist := models.Wishlist{
+		UserID: userID.(uint),
+		Name:   req.Name,
+	}
+	if err := h.share(&wishlist, req.Shared); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	if err := h.db.Create(&wishlist).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Wishlist created successfully",
+		"wishlist": wishlist,
+	})
+}
+
+func (h *WishlistHandler) GetWishlist(c *gin.Context) {
+	wishlist, ok := h.wishlist(c)
+	if !ok {
+		return
+	}
+
+	h.db.Preload("Items.Product").First(wishlist, wishlist.ID)
+	c.JSON(http.StatusOK, gin.H{"wishlist": wishlist})
+}
+
+// UpdateWishlist renames a wishlist and turns its share link on or off.
+// Turning sharing off and on again gives the list a new link.
+func (h *WishlistHandler) UpdateWishlist(c *gin.Context) {
+	wishlist, ok := h.wishlist(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWishlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.Shared != nil {
+		if err := h.share(wishlist, *req.Shared); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+			return
+		}
+		updates["share_token"] = wishlist.ShareToken
+	}
+
+	if len(updates) > 0 {
+		if err := h.db.Model(wishlist).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update wishlist"})
+			return
+		}
+	}
+
+	h.db.First(wishlist, wishlist.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Wishlist updated successfully",
+		"wishlist": wishlist,
+	})
+}
+
+func (h *WishlistHandler) DeleteWishlist(c *gin.Context) {
+	wishlist, ok := h.wishlist(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", wishlist.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(wishlist).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist deleted successfully"})
+}
+
+// addWishlistItem puts a product on a wishlist, adding to the quantity if
+// it is already there.
+func addWishlistItem(tx *gorm.DB, wishlistID, productID uint, quantity int, note string) (*models.WishlistItem, error) {
+	var item models.WishlistItem
+	tx.Where("wishlist_id = ? AND product_id = ?", wishlistID, productID).Limit(1).Find(&item)
+	if item.ID == 0 {
+		item = models.WishlistItem{WishlistID: wishlistID, ProductID: productID}
+	}
+	item.Quantity += quantity
+	if note != "" {
+		item.Note = note
+	}
+	if err := tx.Save(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (h *WishlistHandler) AddItem(c *gin.Context) {
+	wishlist, ok := h.wishlist(c)
+	if !ok {
+		return
+	}
+
+	var req AddWishlistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	var product models.Product
+	if err := catalog.Visible(h.db, wishlist.UserID, "").First(&product, req.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	item, err := addWishlistItem(h.db, wishlist.ID, product.ID, req.Quantity, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item to wishlist"})
+		return
+	}
+
+	h.db.Preload("Product").First(item, item.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Item added to wishlist successfully",
+		"item":    item,
+	})
+}
+
+func (h *WishlistHandler) RemoveItem(c *gin.Context) {
+	wishlist, ok := h.wishlist(c)
+	if !ok {
+		return
+	}
+
+	result := h.db.Where("id = ? AND wishlist_id = ?", c.Param("itemId"), wishlist.ID).
+		Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove item from wishlist"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist item not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item removed from wishlist successfully"})
+}
+
+// MoveToCart adds a wishlist item to the caller's cart and takes it off the
+// wishlist.
+func (h *WishlistHandler) MoveToCart(c *gin.Context) {
+	wishlist, ok := h.wishlist(c)
+	if !ok {
+		return
+	}
+
+	var item models.WishlistItem
+	if err := h.db.Where("id = ? AND wishlist_id = ?", c.Param("itemId"), wishlist.ID).
+		Preload("Product").
+		First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist item not found"})
+		return
+	}
+
+	var cartItem *models.Cart
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cartItem, _, err = h.carts.addItem(tx, cartOwner{userID: wishlist.UserID}, &item.Product, item.Quantity)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&item).Error
+	})
+	var stockErr *inventory.StockError
+	if errors.Is(err, errProductUnavailable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This product is no longer available"})
+		return
+	}
+	if errors.As(err, &stockErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": stockErr.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move item to cart"})
+		return
+	}
+
+	h.db.Preload("Product").First(cartItem, cartItem.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Item moved to cart successfully",
+		"cart_item": cartItem,
+	})
+}
+
+// SaveForLater moves a cart line to the caller's save-for-later list,
+// creating the list the first time.
+func (h *WishlistHandler) SaveForLater(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to save items for later"})
+		return
+	}
+	owner := cartOwner{userID: userID.(uint)}
+
+	var cartItem models.Cart
+	if err := owner.scope(h.db).Where("id = ?", c.Param("id")).First(&cartItem).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+		return
+	}
+
+	var item *models.WishlistItem
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		wishlist := models.Wishlist{
+			UserID:        owner.userID,
+			Name:          savedForLaterName,
+			SavedForLater: true,
+		}
+		if err := tx.Where("user_id = ? AND saved_for_later = ?", owner.userID, true).
+			FirstOrCreate(&wishlist).Error; err != nil {
+			return err
+		}
+
+		var err error
+		item, err = addWishlistItem(tx, wishlist.ID, cartItem.ProductID, cartItem.Quantity, "")
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&cartItem).Error; err != nil {
+			return err
+		}
+		return h.carts.release(tx, owner, cartItem.ProductID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save item for later"})
+		return
+	}
+
+	h.db.Preload("Product").First(item, item.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Item saved for later",
+		"item":    item,
+	})
+}
+
+// GetSharedWishlist shows a shared wishlist to anyone with its link. Only
+// products that are for sale are listed.
+func (h *WishlistHandler) GetSharedWishlist(c *gin.Context) {
+	var wishlist models.Wishlist
+	if err := h.db.Where("share_token = ?", c.Param("token")).
+		Preload("User").
+		Preload("Items", "product_id IN (?)", h.db.Model(&models.Product{}).
+			Select("id").
+			Where("status = ?", catalog.StatusPublished)).
+		Preload("Items.Product").
+		First(&wishlist).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wishlist": gin.H{
+			"name":  wishlist.Name,
+			"owner": wishlist.User.FirstName,
+			"items": wishlist.Items,
+		},
+	})
+}
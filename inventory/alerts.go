@@ -0,0 +1,62 @@
+package inventory
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
+)
+
+// SendStockAlerts tells owners about products that have fallen to their
+// low-stock threshold and subscribers about products that are back in stock.
+// Each alert is sent once per crossing.
+func SendStockAlerts(db *gorm.DB, notifier notify.Notifier) error {
+	if err := db.Model(&models.Product{}).
+		Where("low_stock_notified_at IS NOT NULL AND stock > low_stock_threshold").
+		UpdateColumn("low_stock_notified_at", nil).Error; err != nil {
+		return err
+	}
+
+	var low []models.Product
+	if err := db.Preload("Owner").
+		Where("low_stock_threshold > 0 AND stock <= low_stock_threshold AND low_stock_notified_at IS NULL").
+		Find(&low).Error; err != nil {
+		return err
+	}
+	for i := range low {
+		product := &low[i]
+		notifier.Send(notify.Message{
+			To:      product.Owner.Email,
+			Subject: "Low stock: " + product.Name,
+			Body: fmt.Sprintf("%s is down to %d in stock (threshold %d).",
+				product.Name, product.Stock, product.LowStockThreshold),
+		})
+		if err := db.Model(product).UpdateColumn("low_stock_notified_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+
+	var subscriptions []models.StockSubscription
+	if err := db.Preload("User").
+		Preload("Product").
+		Joins("JOIN products ON products.id = stock_subscriptions.product_id AND products.deleted_at IS NULL").
+		Where("stock_subscriptions.notified_at IS NULL AND products.stock > 0").
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		notifier.Send(notify.Message{
+			To:      subscription.User.Email,
+			Subject: subscription.Product.Name + " is back in stock",
+			Body:    fmt.Sprintf("%s is available again.", subscription.Product.Name),
+		})
+		if err := db.Model(subscription).UpdateColumn("notified_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package inventory
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Types of stock movement.
+const (
+	MovementInitial    = "initial"
+	MovementOrder      = "order"
+	MovementCancel     = "cancel"
+	MovementAdjustment = "adjustment"
+	MovementReturn     = "return"
+	MovementTransfer   = "transfer"
+	MovementImport     = "import"
+)
+
+func warehouseRef(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// Record appends a movement to the stock ledger. Movements without a delta
+// are skipped.
+func Record(tx *gorm.DB, movement *models.StockMovement) error {
+	if movement.Delta == 0 {
+		return nil
+	}
+	return tx.Create(movement).Error
+}
+
+// SetStock overwrites the stock of a product that is not managed per
+// warehouse and records the difference as entry.
+func SetStock(tx *gorm.DB, product *models.Product, stock int, entry models.StockMovement) error {
+	entry.ProductID = product.ID
+	entry.Delta = stock - product.Stock
+	if err := tx.Model(product).UpdateColumn("stock", stock).Error; err != nil {
+		return err
+	}
+	product.Stock = stock
+	return Record(tx, &entry)
+}
+
+// Restock puts the stock of cancelled order items back in the warehouses it
+// was allocated from. Whatever was not allocated goes back to unassigned
+// stock. The movements are recorded as made by actorID, or by the system
+// when nil.
+func Restock(tx *gorm.DB, orderID uint, items []models.OrderItem, actorID *uint) error {
+	entry := models.StockMovement{
+		Type:    MovementCancel,
+		Reason:  "order_cancelled",
+		Note:    fmt.Sprintf("order #%d cancelled", orderID),
+		ActorID: actorID,
+		OrderID: &orderID,
+	}
+	for _, item := range items {
+		var allocations []models.StockAllocation
+		if err := tx.Where("order_item_id = ?", item.ID).Find(&allocations).Error; err != nil {
+			return err
+		}
+
+		remaining := item.Quantity
+		for _, allocation := range allocations {
+			level, err := stockLevel(tx, item.ProductID, allocation.WarehouseID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(level).UpdateColumn("quantity", gorm.Expr("quantity + ?", allocation.Quantity)).Error; err != nil {
+				return err
+			}
+			movement := entry
+			movement.ProductID = item.ProductID
+			movement.WarehouseID = warehouseRef(allocation.WarehouseID)
+			movement.Delta = allocation.Quantity
+			if err := Record(tx, &movement); err != nil {
+				return err
+			}
+			remaining -= allocation.Quantity
+		}
+
+		movement := entry
+		movement.ProductID = item.ProductID
+		movement.Delta = remaining
+		if err := Record(tx, &movement); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Product{}).
+			Where("id = ?", item.ProductID).
+			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package inventory
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Drift is a stock figure that disagrees with the stock ledger. WarehouseID
+// is nil for a product's total stock.
+type Drift struct {
+	ProductID   uint
+	WarehouseID *uint
+	Recorded    int
+	Ledger      int
+}
+
+// SeedOpeningBalances records the current stock of products that have no
+// movements yet, such as those created before the stock ledger existed.
+func SeedOpeningBalances(db *gorm.DB) (int, error) {
+	var products []models.Product
+	if err := db.Where("id NOT IN (?)", db.Model(&models.StockMovement{}).Select("product_id")).
+		Find(&products).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range products {
+		product := &products[i]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var levels []models.StockLevel
+			if err := tx.Where("product_id = ?", product.ID).Find(&levels).Error; err != nil {
+				return err
+			}
+
+			unassigned := product.Stock
+			for _, level := range levels {
+				if err := Record(tx, &models.StockMovement{
+					ProductID:   product.ID,
+					WarehouseID: warehouseRef(level.WarehouseID),
+					Delta:       level.Quantity,
+					Type:        MovementInitial,
+					Reason:      "opening_balance",
+				}); err != nil {
+					return err
+				}
+				unassigned -= level.Quantity
+			}
+			return Record(tx, &models.StockMovement{
+				ProductID: product.ID,
+				Delta:     unassigned,
+				Type:      MovementInitial,
+				Reason:    "opening_balance",
+			})
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Reconcile recomputes every product's stock and warehouse stock levels from
+// the stock ledger and returns those that differ.
+func Reconcile(db *gorm.DB) ([]Drift, error) {
+	var totals []struct {
+		ProductID uint
+		Stock     int
+		Ledger    int
+	}
+	if err := db.Model(&models.Product{}).
+		Select("products.id AS product_id, products.stock, COALESCE(SUM(stock_movements.delta), 0) AS ledger").
+		Joins("LEFT JOIN stock_movements ON stock_movements.product_id = products.id").
+		Group("products.id").
+		Order("products.id").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, total := range totals {
+		if total.Stock != total.Ledger {
+			drifts = append(drifts, Drift{ProductID: total.ProductID, Recorded: total.Stock, Ledger: total.Ledger})
+		}
+	}
+
+	var levels []struct {
+		ProductID   uint
+		WarehouseID uint
+		Quantity    int
+		Ledger      int
+	}
+	if err := db.Model(&models.StockLevel{}).
+		Select("stock_levels.product_id, stock_levels.warehouse_id, stock_levels.quantity, COALESCE(SUM(stock_movements.delta), 0) AS ledger").
+		Joins("LEFT JOIN stock_movements ON stock_movements.product_id = stock_levels.product_id AND stock_movements.warehouse_id = stock_levels.warehouse_id").
+		Group("stock_levels.id").
+		Order("stock_levels.product_id, stock_levels.warehouse_id").
+		Scan(&levels).Error; err != nil {
+		return nil, err
+	}
+
+	for _, level := range levels {
+		if level.Quantity != level.Ledger {
+			drifts = append(drifts, Drift{
+				ProductID:   level.ProductID,
+				WarehouseID: warehouseRef(level.WarehouseID),
+				Recorded:    level.Quantity,
+				Ledger:      level.Ledger,
+			})
+		}
+	}
+	return drifts, nil
+}
+
+// ApplyDrift overwrites a drifted stock figure with the ledger's value.
+func ApplyDrift(db *gorm.DB, drift Drift) error {
+	if drift.WarehouseID == nil {
+		return db.Model(&models.Product{}).
+			Where("id = ?", drift.ProductID).
+			UpdateColumn("stock", drift.Ledger).Error
+	}
+	return db.Model(&models.StockLevel{}).
+		Where("product_id = ? AND warehouse_id = ?", drift.ProductID, *drift.WarehouseID).
+		UpdateColumn("quantity", drift.Ledger).Error
+}
@@ -0,0 +1,206 @@
+package inventory
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// StockError reports that a product does not have enough available stock.
+type StockError struct {
+	ProductID uint
+	Name      string
+}
+
+func (e *StockError) Error() string {
+	return "Insufficient stock for product " + e.Name
+}
+
+func activeReservations(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Reservation{}).
+		Where("status = ? AND expires_at > ?", "active", time.Now())
+}
+
+// Reserved returns the quantity of each product held by active reservations,
+// ignoring the cart and checkout holds of excludeUserID (pass 0 to count all).
+func Reserved(db *gorm.DB, productIDs []uint, excludeUserID uint) map[uint]int {
+	var rows []struct {
+		ProductID uint
+		Quantity  int
+	}
+	query := activeReservations(db).
+		Select("product_id, SUM(quantity) AS quantity").
+		Where("product_id IN ?", productIDs)
+	if excludeUserID != 0 {
+		query = query.Where("NOT (user_id = ? AND order_id IS NULL)", excludeUserID)
+	}
+	query.Group("product_id").Scan(&rows)
+
+	reserved := make(map[uint]int)
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Quantity
+	}
+	return reserved
+}
+
+// Available returns how much of a product userID can still buy: stock on hand
+// minus what other shoppers currently hold.
+func Available(db *gorm.DB, product *models.Product, userID uint) int {
+	return product.Stock - Reserved(db, []uint{product.ID}, userID)[product.ID]
+}
+
+// FillAvailability sets OnHand and Available on the given products.
+func FillAvailability(db *gorm.DB, products []models.Product) {
+	if len(products) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	reserved := Reserved(db, ids, 0)
+
+	for i := range products {
+		onHand := products[i].Stock
+		available := onHand - reserved[products[i].ID]
+		if available < 0 {
+			available = 0
+		}
+		products[i].OnHand = &onHand
+		products[i].Available = &available
+	}
+}
+
+// Reserve holds quantity of a product for a shopper's cart or checkout until
+// ttl passes, replacing any hold they already had on it.
+func Reserve(tx *gorm.DB, userID uint, product *models.Product, quantity int, ttl time.Duration) (*models.Reservation, error) {
+	if Available(tx, product, userID) < quantity {
+		return nil, &StockError{ProductID: product.ID, Name: product.Name}
+	}
+
+	var reservation models.Reservation
+	if err := tx.Where("user_id = ? AND product_id = ? AND status = ? AND order_id IS NULL",
+		userID, product.ID, "active").
+		Limit(1).
+		Find(&reservation).Error; err != nil {
+		return nil, err
+	}
+
+	reservation.UserID = userID
+	reservation.ProductID = product.ID
+	reservation.Status = "active"
+	reservation.Quantity = quantity
+	reservation.ExpiresAt = time.Now().Add(ttl)
+	if err := tx.Save(&reservation).Error; err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// Release drops a shopper's cart or checkout hold on a product.
+func Release(tx *gorm.DB, userID, productID uint) error {
+	return tx.Model(&models.Reservation{}).
+		Where("user_id = ? AND product_id = ? AND status = ? AND order_id IS NULL", userID, productID, "active").
+		Update("status", "released").Error
+}
+
+// ReleaseAll drops every cart or checkout hold of a shopper.
+func ReleaseAll(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.Reservation{}).
+		Where("user_id = ? AND status = ? AND order_id IS NULL", userID, "active").
+		Update("status", "released").Error
+}
+
+// ReserveOrder binds stock to every item of a new order until ttl passes,
+// taking over the shopper's existing holds on the same products.
+func ReserveOrder(tx *gorm.DB, order *models.Order, ttl time.Duration) error {
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+
+		var product models.Product
+		if err := tx.First(&product, item.ProductID).Error; err != nil {
+			return err
+		}
+
+		reservation, err := Reserve(tx, order.UserID, &product, item.Quantity, ttl)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(reservation).Updates(map[string]interface{}{
+			"order_id":      order.ID,
+			"order_item_id": item.ID,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertOrder turns the reservations of a paid order into stock deductions
+// and allocates each item to the warehouses it ships from. Items whose hold
+// already lapsed are deducted if the stock is still there. Items of
+// sub-orders cancelled before payment are not sold and are skipped. The
+// deductions are recorded as made by actorID, or by the system when nil.
+func ConvertOrder(tx *gorm.DB, order *models.Order, actorID *uint) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).
+		Where("seller_order_id IS NULL OR seller_order_id NOT IN (?)",
+			tx.Model(&models.SellerOrder{}).Select("id").Where("order_id = ? AND status = ?", order.ID, "cancelled")).
+		Find(&items).Error; err != nil {
+		return err
+	}
+
+	entry := models.StockMovement{
+		Type:    MovementOrder,
+		Reason:  "order_placed",
+		Note:    fmt.Sprintf("order #%d placed", order.ID),
+		ActorID: actorID,
+		OrderID: &order.ID,
+	}
+	for _, item := range items {
+		var reservation models.Reservation
+		held := tx.Where("order_item_id = ? AND status = ?", item.ID, "active").
+			Limit(1).Find(&reservation).RowsAffected > 0
+
+		var product models.Product
+		if err := tx.First(&product, item.ProductID).Error; err != nil {
+			return err
+		}
+		if !held && Available(tx, &product, order.UserID) < item.Quantity {
+			return &StockError{ProductID: product.ID, Name: product.Name}
+		}
+
+		if err := tx.Model(&product).UpdateColumn("stock", gorm.Expr("stock - ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+		if err := allocate(tx, order, &item, entry); err != nil {
+			return err
+		}
+		if held {
+			if err := tx.Model(&reservation).Update("status", "converted").Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReleaseOrderItems drops the holds of an unpaid order's items.
+func ReleaseOrderItems(tx *gorm.DB, orderItemIDs []uint) error {
+	return tx.Model(&models.Reservation{}).
+		Where("order_item_id IN ? AND status = ?", orderItemIDs, "active").
+		Update("status", "released").Error
+}
+
+// ReleaseExpired releases every cart and checkout hold that has run out.
+func ReleaseExpired(db *gorm.DB) (int64, error) {
+	result := db.Model(&models.Reservation{}).
+		Where("status = ? AND expires_at <= ? AND order_id IS NULL", "active", time.Now()).
+		Update("status", "released")
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,238 @@
+package inventory
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Allocation strategies choosing the warehouses an order ships from.
+const (
+	StrategyMostStocked = "most_stocked"
+	StrategyNearest     = "nearest"
+)
+
+var ErrWarehouseStock = errors.New("insufficient stock in warehouse")
+
+var allocationStrategy = StrategyMostStocked
+
+// Setup sets the allocation strategy used when orders are paid.
+func Setup(cfg *config.Config) {
+	allocationStrategy = cfg.AllocationStrategy
+}
+
+// WarehouseStock is a product's stock level in one warehouse.
+type WarehouseStock struct {
+	WarehouseID uint   `json:"warehouse_id"`
+	Name        string `json:"name"`
+	Code        string `json:"code"`
+	Active      bool   `json:"active"`
+	Quantity    int    `json:"quantity"`
+}
+
+// StockSummary is a product's stock across all of its warehouses.
+type StockSummary struct {
+	OnHand     int              `json:"on_hand"`
+	Reserved   int              `json:"reserved"`
+	Available  int              `json:"available"`
+	Unassigned int              `json:"unassigned"`
+	Warehouses []WarehouseStock `json:"warehouses"`
+}
+
+// Summary aggregates a product's stock levels and reservations.
+func Summary(db *gorm.DB, product *models.Product) (StockSummary, error) {
+	summary := StockSummary{
+		OnHand:     product.Stock,
+		Reserved:   Reserved(db, []uint{product.ID}, 0)[product.ID],
+		Warehouses: []WarehouseStock{},
+	}
+	summary.Available = summary.OnHand - summary.Reserved
+	if summary.Available < 0 {
+		summary.Available = 0
+	}
+
+	if err := db.Model(&models.StockLevel{}).
+		Select("warehouses.id AS warehouse_id, warehouses.name, warehouses.code, warehouses.active, stock_levels.quantity").
+		Joins("JOIN warehouses ON warehouses.id = stock_levels.warehouse_id AND warehouses.deleted_at IS NULL").
+		Where("stock_levels.product_id = ?", product.ID).
+		Order("warehouses.code").
+		Scan(&summary.Warehouses).Error; err != nil {
+		return summary, err
+	}
+
+	summary.Unassigned = summary.OnHand
+	for _, level := range summary.Warehouses {
+		summary.Unassigned -= level.Quantity
+	}
+	return summary, nil
+}
+
+// HasStockLevels reports whether a product's stock is managed per warehouse.
+func HasStockLevels(db *gorm.DB, productID uint) bool {
+	var count int64
+	db.Model(&models.StockLevel{}).Where("product_id = ?", productID).Count(&count)
+	return count > 0
+}
+
+func stockLevel(tx *gorm.DB, productID, warehouseID uint) (*models.StockLevel, error) {
+	level := models.StockLevel{ProductID: productID, WarehouseID: warehouseID}
+	if err := tx.Where(&level).FirstOrCreate(&level).Error; err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+func assigned(tx *gorm.DB, productID uint) int {
+	var total int
+	tx.Model(&models.StockLevel{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("product_id = ?", productID).
+		Scan(&total)
+	return total
+}
+
+// Adjust changes a product's stock in one warehouse by delta, keeping the
+// product's total in step, and records it in the stock ledger as entry.
+func Adjust(tx *gorm.DB, product *models.Product, warehouseID uint, delta int, entry models.StockMovement) (*models.StockLevel, error) {
+	level, err := stockLevel(tx, product.ID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	if level.Quantity+delta < 0 {
+		return nil, ErrWarehouseStock
+	}
+
+	if err := tx.Model(level).UpdateColumn("quantity", gorm.Expr("quantity + ?", delta)).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(product).UpdateColumn("stock", gorm.Expr("stock + ?", delta)).Error; err != nil {
+		return nil, err
+	}
+	level.Quantity += delta
+	product.Stock += delta
+
+	entry.ProductID = product.ID
+	entry.WarehouseID = warehouseRef(warehouseID)
+	entry.Delta = delta
+	if err := Record(tx, &entry); err != nil {
+		return nil, err
+	}
+	return level, nil
+}
+
+// Transfer moves stock of a product between warehouses without changing its
+// total. A fromID of 0 takes the stock from what is not yet assigned to any
+// warehouse. Both legs are recorded in the stock ledger as entry.
+func Transfer(tx *gorm.DB, product *models.Product, fromID, toID uint, quantity int, entry models.StockMovement) error {
+	if fromID == 0 {
+		if product.Stock-assigned(tx, product.ID) < quantity {
+			return ErrWarehouseStock
+		}
+	} else {
+		from, err := stockLevel(tx, product.ID, fromID)
+		if err != nil {
+			return err
+		}
+		if from.Quantity < quantity {
+			return ErrWarehouseStock
+		}
+		if err := tx.Model(from).UpdateColumn("quantity", gorm.Expr("quantity - ?", quantity)).Error; err != nil {
+			return err
+		}
+	}
+
+	to, err := stockLevel(tx, product.ID, toID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(to).UpdateColumn("quantity", gorm.Expr("quantity + ?", quantity)).Error; err != nil {
+		return err
+	}
+
+	out, in := entry, entry
+	out.ProductID, out.WarehouseID, out.Delta = product.ID, warehouseRef(fromID), -quantity
+	in.ProductID, in.WarehouseID, in.Delta = product.ID, warehouseRef(toID), quantity
+	if err := Record(tx, &out); err != nil {
+		return err
+	}
+	return Record(tx, &in)
+}
+
+// allocate takes an order item's quantity from the stock levels of active
+// warehouses, nearest to the shipping address or most stocked first, and
+// records where it ships from in the allocations and the stock ledger.
+// Whatever the warehouses cannot cover comes from the product's unassigned
+// stock. Each movement is recorded as a copy of entry.
+func allocate(tx *gorm.DB, order *models.Order, item *models.OrderItem, entry models.StockMovement) error {
+	var levels []models.StockLevel
+	if err := tx.Preload("Warehouse").
+		Joins("JOIN warehouses ON warehouses.id = stock_levels.warehouse_id AND warehouses.deleted_at IS NULL").
+		Where("stock_levels.product_id = ? AND stock_levels.quantity > 0 AND warehouses.active = ?", item.ProductID, true).
+		Find(&levels).Error; err != nil {
+		return err
+	}
+
+	nearest := allocationStrategy == StrategyNearest &&
+		order.ShippingLatitude != nil && order.ShippingLongitude != nil
+	sort.SliceStable(levels, func(i, j int) bool {
+		if nearest {
+			di := distance(*order.ShippingLatitude, *order.ShippingLongitude, levels[i].Warehouse.Latitude, levels[i].Warehouse.Longitude)
+			dj := distance(*order.ShippingLatitude, *order.ShippingLongitude, levels[j].Warehouse.Latitude, levels[j].Warehouse.Longitude)
+			if di != dj {
+				return di < dj
+			}
+		}
+		return levels[i].Quantity > levels[j].Quantity
+	})
+
+	remaining := item.Quantity
+	for i := range levels {
+		if remaining == 0 {
+			break
+		}
+		take := levels[i].Quantity
+		if take > remaining {
+			take = remaining
+		}
+
+		if err := tx.Model(&levels[i]).UpdateColumn("quantity", gorm.Expr("quantity - ?", take)).Error; err != nil {
+			return err
+		}
+		allocation := models.StockAllocation{
+			OrderItemID: item.ID,
+			WarehouseID: levels[i].WarehouseID,
+			Quantity:    take,
+		}
+		if err := tx.Create(&allocation).Error; err != nil {
+			return err
+		}
+		movement := entry
+		movement.ProductID = item.ProductID
+		movement.WarehouseID = warehouseRef(levels[i].WarehouseID)
+		movement.Delta = -take
+		if err := Record(tx, &movement); err != nil {
+			return err
+		}
+		remaining -= take
+	}
+
+	entry.ProductID = item.ProductID
+	entry.Delta = -remaining
+	return Record(tx, &entry)
+}
+
+// distance is the great-circle distance in kilometres between two points.
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
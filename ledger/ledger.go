@@ -0,0 +1,261 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Accounts of the double-entry ledger. Cash is what the platform holds,
+// seller_payable is what it owes each seller and commission_revenue is what
+// it keeps.
+const (
+	AccountCash              = "cash"
+	AccountSellerPayable     = "seller_payable"
+	AccountCommissionRevenue = "commission_revenue"
+)
+
+const (
+	KindSale       = "sale"
+	KindCommission = "commission"
+	KindRefund     = "refund"
+	KindPayout     = "payout"
+)
+
+var ErrUnbalanced = errors.New("ledger transaction is not balanced")
+
+var defaultCommissionPercent = 10.0
+
+// Setup sets the commission charged when no CommissionRate matches.
+func Setup(cfg *config.Config) {
+	defaultCommissionPercent = cfg.CommissionPercent
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func sellerRef(id uint) *uint {
+	return &id
+}
+
+// post stores a transaction after checking that its debits equal its credits.
+func post(tx *gorm.DB, transaction *models.LedgerTransaction) error {
+	var debits, credits float64
+	for i := range transaction.Entries {
+		entry := &transaction.Entries[i]
+		entry.Debit = round(entry.Debit)
+		entry.Credit = round(entry.Credit)
+		debits += entry.Debit
+		credits += entry.Credit
+	}
+	if round(debits) != round(credits) {
+		return ErrUnbalanced
+	}
+	return tx.Create(transaction).Error
+}
+
+// CommissionPercent returns the most specific rate for a seller's product in
+// a category: seller and category, then seller, then category, then default.
+func CommissionPercent(tx *gorm.DB, sellerID uint, category string) float64 {
+	var rates []models.CommissionRate
+	tx.Where("(seller_id = ? OR seller_id IS NULL) AND (category = ? OR category = '')", sellerID, category).
+		Find(&rates)
+
+	best, bestScore := defaultCommissionPercent, -1
+	for _, rate := range rates {
+		score := 0
+		if rate.SellerID != nil {
+			score += 2
+		}
+		if rate.Category != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rate.Percent, score
+		}
+	}
+	return best
+}
+
+// RecordSale credits the seller with a paid sub-order and charges the
+// platform commission on each of its items.
+func RecordSale(tx *gorm.DB, sellerOrder *models.SellerOrder) error {
+	var existing int64
+	tx.Model(&models.LedgerTransaction{}).
+		Where("seller_order_id = ? AND kind = ?", sellerOrder.ID, KindSale).
+		Count(&existing)
+	if existing > 0 {
+		return nil
+	}
+
+	var items []models.OrderItem
+	if err := tx.Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("seller_order_id = ?", sellerOrder.ID).
+		Find(&items).Error; err != nil {
+		return err
+	}
+
+	var commission float64
+	for _, item := range items {
+		percent := CommissionPercent(tx, sellerOrder.SellerID, item.Product.Category)
+		commission += float64(item.Quantity) * item.Price * percent / 100
+	}
+	commission = round(commission)
+
+	sale := models.LedgerTransaction{
+		Kind:          KindSale,
+		OrderID:       &sellerOrder.OrderID,
+		SellerOrderID: &sellerOrder.ID,
+		Memo:          fmt.Sprintf("Sale for order #%d", sellerOrder.OrderID),
+		Entries: []models.LedgerEntry{
+			{Account: AccountCash, Debit: sellerOrder.Subtotal},
+			{Account: AccountSellerPayable, SellerID: sellerRef(sellerOrder.SellerID), Credit: sellerOrder.Subtotal},
+		},
+	}
+	if err := post(tx, &sale); err != nil {
+		return err
+	}
+
+	if commission == 0 {
+		return nil
+	}
+	fee := models.LedgerTransaction{
+		Kind:          KindCommission,
+		OrderID:       &sellerOrder.OrderID,
+		SellerOrderID: &sellerOrder.ID,
+		Memo:          fmt.Sprintf("Commission for order #%d", sellerOrder.OrderID),
+		Entries: []models.LedgerEntry{
+			{Account: AccountSellerPayable, SellerID: sellerRef(sellerOrder.SellerID), Debit: commission},
+			{Account: AccountCommissionRevenue, Credit: commission},
+		},
+	}
+	return post(tx, &fee)
+}
+
+// RecordRefund reverses the sale and commission of a sub-order that was paid
+// and then cancelled. Sub-orders that were never paid are ignored.
+func RecordRefund(tx *gorm.DB, sellerOrder *models.SellerOrder) error {
+	var recorded []models.LedgerTransaction
+	if err := tx.Preload("Entries").
+		Where("seller_order_id = ?", sellerOrder.ID).
+		Find(&recorded).Error; err != nil {
+		return err
+	}
+
+	var sold, refunded bool
+	var commission float64
+	for _, transaction := range recorded {
+		switch transaction.Kind {
+		case KindSale:
+			sold = true
+		case KindRefund:
+			refunded = true
+		case KindCommission:
+			for _, entry := range transaction.Entries {
+				commission += entry.Credit
+			}
+		}
+	}
+	if !sold || refunded {
+		return nil
+	}
+
+	entries := []models.LedgerEntry{
+		{Account: AccountSellerPayable, SellerID: sellerRef(sellerOrder.SellerID), Debit: sellerOrder.Subtotal},
+		{Account: AccountCash, Credit: sellerOrder.Subtotal},
+	}
+	if commission > 0 {
+		entries = append(entries,
+			models.LedgerEntry{Account: AccountCommissionRevenue, Debit: commission},
+			models.LedgerEntry{Account: AccountSellerPayable, SellerID: sellerRef(sellerOrder.SellerID), Credit: commission},
+		)
+	}
+
+	refund := models.LedgerTransaction{
+		Kind:          KindRefund,
+		OrderID:       &sellerOrder.OrderID,
+		SellerOrderID: &sellerOrder.ID,
+		Memo:          fmt.Sprintf("Refund for order #%d", sellerOrder.OrderID),
+		Entries:       entries,
+	}
+	return post(tx, &refund)
+}
+
+// RecordPayout moves a payout to a seller out of their payable balance.
+func RecordPayout(tx *gorm.DB, payout *models.Payout) error {
+	transaction := models.LedgerTransaction{
+		Kind:     KindPayout,
+		PayoutID: &payout.ID,
+		Memo:     fmt.Sprintf("Payout batch %s", payout.Batch),
+		Entries: []models.LedgerEntry{
+			{Account: AccountSellerPayable, SellerID: sellerRef(payout.SellerID), Debit: payout.Amount},
+			{Account: AccountCash, Credit: payout.Amount},
+		},
+	}
+	return post(tx, &transaction)
+}
+
+// SellerBalance is a seller's payable balance broken down by transaction kind.
+type SellerBalance struct {
+	SellerID   uint    `json:"seller_id"`
+	Balance    float64 `json:"balance"`
+	Sales      float64 `json:"sales"`
+	Commission float64 `json:"commission"`
+	Refunds    float64 `json:"refunds"`
+	Payouts    float64 `json:"payouts"`
+}
+
+func Summary(db *gorm.DB, sellerID uint) (SellerBalance, error) {
+	var rows []struct {
+		Kind   string
+		Amount float64
+	}
+	err := db.Model(&models.LedgerEntry{}).
+		Select("ledger_transactions.kind AS kind, SUM(ledger_entries.credit - ledger_entries.debit) AS amount").
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_entries.account = ? AND ledger_entries.seller_id = ?", AccountSellerPayable, sellerID).
+		Group("ledger_transactions.kind").
+		Scan(&rows).Error
+	if err != nil {
+		return SellerBalance{}, err
+	}
+
+	summary := SellerBalance{SellerID: sellerID}
+	for _, row := range rows {
+		switch row.Kind {
+		case KindSale:
+			summary.Sales = round(row.Amount)
+		case KindCommission:
+			summary.Commission = round(-row.Amount)
+		case KindRefund:
+			summary.Refunds = round(-row.Amount)
+		case KindPayout:
+			summary.Payouts = round(-row.Amount)
+		}
+		summary.Balance += row.Amount
+	}
+	summary.Balance = round(summary.Balance)
+	return summary, nil
+}
+
+// SellersWithBalance lists every seller whose payable balance is at least min.
+func SellersWithBalance(db *gorm.DB, min float64) ([]SellerBalance, error) {
+	var balances []SellerBalance
+	err := db.Model(&models.LedgerEntry{}).
+		Select("seller_id, SUM(credit - debit) AS balance").
+		Where("account = ? AND seller_id IS NOT NULL", AccountSellerPayable).
+		Group("seller_id").
+		Having("SUM(credit - debit) >= ?", min).
+		Order("seller_id").
+		Scan(&balances).Error
+	for i := range balances {
+		balances[i].Balance = round(balances[i].Balance)
+	}
+	return balances, err
+}
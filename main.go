@@ -7,15 +7,32 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"github.com/hannanmiah/golang-tutorial/cart"
+	"github.com/hannanmiah/golang-tutorial/catalog"
 	"github.com/hannanmiah/golang-tutorial/config"
+	"github.com/hannanmiah/golang-tutorial/documents"
 	"github.com/hannanmiah/golang-tutorial/handlers"
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/jobs"
+	"github.com/hannanmiah/golang-tutorial/ledger"
 	"github.com/hannanmiah/golang-tutorial/middleware"
 	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/notify"
+	"github.com/hannanmiah/golang-tutorial/orders"
+	"github.com/hannanmiah/golang-tutorial/reports"
 )
 
 func main() {
 	cfg := config.LoadConfig()
 
+	if err := middleware.Setup(cfg); err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	ledger.Setup(cfg)
+	inventory.Setup(cfg)
+	cart.Setup(cfg)
+	documents.Setup(cfg)
+
 	db, err := gorm.Open(sqlite.Open(cfg.DatabasePath), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
@@ -27,10 +44,55 @@ func main() {
 		&models.Cart{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.LoginThrottle{},
+		&models.APIKey{},
+		&models.DataExport{},
+		&models.SellerProfile{},
+		&models.SellerOrder{},
+		&models.CommissionRate{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.Payout{},
+		&models.Reservation{},
+		&models.Warehouse{},
+		&models.StockLevel{},
+		&models.StockAllocation{},
+		&models.StockMovement{},
+		&models.StockSubscription{},
+		&models.ProductImport{},
+		&models.PriceChange{},
+		&models.ScheduledPrice{},
+		&models.Wishlist{},
+		&models.WishlistItem{},
+		&models.AbandonedCart{},
+		&models.Sequence{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.DailySalesRollup{},
 	); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// Orders placed before they were split by seller get their sub-orders.
+	count, err := orders.BackfillSellerOrders(db)
+	if err != nil {
+		log.Fatal("Failed to backfill seller orders:", err)
+	}
+	if count > 0 {
+		log.Printf("Split %d existing orders into seller orders", count)
+	}
+
+	jobs.Every("reservations", cfg.ReservationSweepInterval, func() error {
+		return orders.SweepReservations(db)
+	})
+
+	jobs.Every("product schedules", cfg.PublishScheduleInterval, func() error {
+		if err := catalog.ApplySchedules(db); err != nil {
+			return err
+		}
+		return catalog.ApplyPriceSchedules(db)
+	})
+
 	router := gin.Default()
 
 	router.GET("/", func(c *gin.Context) {
@@ -40,43 +102,163 @@ func main() {
 		})
 	})
 
-	userHandler := handlers.NewUserHandler(db)
+	notifier := notify.NewLogNotifier()
+
+	jobs.Every("stock alerts", cfg.StockAlertInterval, func() error {
+		return inventory.SendStockAlerts(db, notifier)
+	})
+
+	jobs.Every("abandoned carts", cfg.AbandonedCartInterval, func() error {
+		return cart.SweepAbandoned(db, notifier)
+	})
+
+	jobs.Every("sales rollups", cfg.ReportRollupInterval, func() error {
+		_, err := reports.Rollup(db, cfg.ReportRollupDays)
+		return err
+	})
+
+	userHandler := handlers.NewUserHandler(db, cfg, notifier)
 	productHandler := handlers.NewProductHandler(db)
-	cartHandler := handlers.NewCartHandler(db)
-	orderHandler := handlers.NewOrderHandler(db)
+	cartHandler := handlers.NewCartHandler(db, cfg)
+	orderHandler := handlers.NewOrderHandler(db, cfg)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	exportHandler := handlers.NewExportHandler(db, cfg, notifier)
+	if err := exportHandler.FailInterrupted(); err != nil {
+		log.Println("Failed to clean up interrupted exports:", err)
+	}
+	jobs.Every("expired exports", cfg.ExportSweepInterval, exportHandler.SweepExpired)
+	sellerHandler := handlers.NewSellerHandler(db)
+	warehouseHandler := handlers.NewWarehouseHandler(db)
+	productImportHandler := handlers.NewProductImportHandler(db, cfg, notifier)
+	if err := productImportHandler.FailInterrupted(); err != nil {
+		log.Println("Failed to clean up interrupted product imports:", err)
+	}
+	trashHandler := handlers.NewTrashHandler(db)
+	priceHandler := handlers.NewPriceHandler(db)
+	wishlistHandler := handlers.NewWishlistHandler(db, cfg)
+	shipmentHandler := handlers.NewShipmentHandler(db, notifier)
+	reportHandler := handlers.NewReportHandler(db)
+
+	router.GET("/.well-known/jwks.json", middleware.JWKSHandler())
 
 	router.POST("/register", userHandler.Register)
 	router.POST("/login", userHandler.Login)
+	router.POST("/verify-email", userHandler.VerifyEmail)
+	router.GET("/exports/:token", exportHandler.DownloadExport)
+	router.GET("/shared/wishlists/:token", wishlistHandler.GetSharedWishlist)
+
+	guest := router.Group("/cart")
+	guest.Use(middleware.OptionalAuthMiddleware(db))
+	{
+		guest.GET("", cartHandler.GetCart)
+		guest.POST("", cartHandler.AddToCart)
+		guest.PUT("", cartHandler.SetCart)
+		guest.PUT("/:id", cartHandler.UpdateCartItem)
+		guest.DELETE("/:id", cartHandler.RemoveFromCart)
+		guest.DELETE("", cartHandler.ClearCart)
+		guest.POST("/:id/save-for-later", wishlistHandler.SaveForLater)
+	}
 
 	protected := router.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(db))
 	{
 		protected.GET("/profile", userHandler.Profile)
+		protected.PATCH("/profile", userHandler.UpdateProfile)
+		protected.DELETE("/profile", userHandler.DeleteAccount)
+		protected.POST("/profile/password", userHandler.ChangePassword)
+		protected.POST("/profile/export", exportHandler.CreateExport)
+		protected.GET("/profile/exports", exportHandler.GetExports)
+		protected.GET("/profile/api-keys", apiKeyHandler.GetAPIKeys)
+		protected.POST("/profile/api-keys", apiKeyHandler.CreateAPIKey)
+		protected.DELETE("/profile/api-keys/:id", apiKeyHandler.RevokeAPIKey)
 		
 		protected.GET("/products", productHandler.GetProducts)
 		protected.GET("/products/:id", productHandler.GetProduct)
 		protected.POST("/products", productHandler.CreateProduct)
 		protected.PUT("/products/:id", productHandler.UpdateProduct)
 		protected.DELETE("/products/:id", productHandler.DeleteProduct)
+		protected.PUT("/products/:id/schedule", productHandler.ScheduleProduct)
 		protected.GET("/my-products", productHandler.GetMyProducts)
+		protected.POST("/products/import", productImportHandler.ImportProducts)
+		protected.GET("/my-products/imports", productImportHandler.GetImports)
+		protected.GET("/my-products/imports/:id", productImportHandler.GetImport)
+		protected.GET("/my-products/export", productImportHandler.ExportProducts)
+		protected.POST("/products/:id/stock/adjust", warehouseHandler.AdjustStock)
+		protected.POST("/products/:id/stock/transfer", warehouseHandler.TransferStock)
+		protected.GET("/products/:id/stock-movements", warehouseHandler.GetStockMovements)
+		protected.POST("/products/:id/notify-me", productHandler.NotifyMe)
+		protected.DELETE("/products/:id/notify-me", productHandler.CancelNotifyMe)
+		protected.GET("/products/:id/price-history", priceHandler.GetPriceHistory)
+		protected.GET("/products/:id/price-schedules", priceHandler.GetPriceSchedules)
+		protected.POST("/products/:id/price-schedules", priceHandler.CreatePriceSchedule)
+		protected.DELETE("/products/:id/price-schedules/:scheduleId", priceHandler.CancelPriceSchedule)
 		
-		protected.GET("/cart", cartHandler.GetCart)
-		protected.POST("/cart", cartHandler.AddToCart)
-		protected.PUT("/cart/:id", cartHandler.UpdateCartItem)
-		protected.DELETE("/cart/:id", cartHandler.RemoveFromCart)
-		protected.DELETE("/cart", cartHandler.ClearCart)
+		protected.POST("/checkout", cartHandler.Checkout)
+
+		protected.GET("/wishlists", wishlistHandler.GetWishlists)
+		protected.POST("/wishlists", wishlistHandler.CreateWishlist)
+		protected.GET("/wishlists/:id", wishlistHandler.GetWishlist)
+		protected.PUT("/wishlists/:id", wishlistHandler.UpdateWishlist)
+		protected.DELETE("/wishlists/:id", wishlistHandler.DeleteWishlist)
+		protected.POST("/wishlists/:id/items", wishlistHandler.AddItem)
+		protected.DELETE("/wishlists/:id/items/:itemId", wishlistHandler.RemoveItem)
+		protected.POST("/wishlists/:id/items/:itemId/move-to-cart", wishlistHandler.MoveToCart)
 		
 		protected.GET("/orders", orderHandler.GetOrders)
 		protected.GET("/orders/:id", orderHandler.GetOrder)
 		protected.POST("/orders", orderHandler.CreateOrder)
+		protected.POST("/orders/:id/reorder", orderHandler.Reorder)
+		protected.GET("/orders/:id/invoice.pdf", orderHandler.GetInvoice)
+		protected.GET("/orders/:id/shipments", shipmentHandler.GetOrderShipments)
+
+		protected.GET("/sellers/:id", sellerHandler.GetStorefront)
+		protected.GET("/seller/profile", sellerHandler.GetSellerProfile)
+		protected.PUT("/seller/profile", sellerHandler.SaveSellerProfile)
+		protected.GET("/seller/orders", sellerHandler.GetSellerOrders)
+		protected.GET("/seller/orders/:id", sellerHandler.GetSellerOrder)
+		protected.PUT("/seller/orders/:id/status", sellerHandler.UpdateSellerOrderStatus)
+		protected.POST("/seller/orders/:id/shipments", shipmentHandler.CreateSellerShipment)
+		protected.PUT("/seller/shipments/:id/status", shipmentHandler.UpdateSellerShipmentStatus)
+		protected.GET("/seller/balance", sellerHandler.GetBalance)
+		protected.GET("/seller/ledger", sellerHandler.GetLedger)
 	}
 
 	admin := router.Group("/admin")
-	admin.Use(middleware.AuthMiddleware())
+	admin.Use(middleware.AuthMiddleware(db))
 	admin.Use(middleware.AdminMiddleware())
 	{
 		admin.GET("/orders", orderHandler.GetAllOrders)
+		admin.GET("/orders/export.csv", orderHandler.ExportOrders)
 		admin.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+		admin.GET("/orders/:id/packing-slip.pdf", orderHandler.GetPackingSlip)
+		admin.POST("/orders/:id/shipments", shipmentHandler.CreateShipment)
+		admin.PUT("/shipments/:id/status", shipmentHandler.UpdateShipmentStatus)
+
+		admin.GET("/reports/revenue", reportHandler.GetRevenue)
+		admin.GET("/reports/orders-by-status", reportHandler.GetOrdersByStatus)
+		admin.GET("/reports/top-products", reportHandler.GetTopProducts)
+		admin.GET("/reports/customers", reportHandler.GetCustomers)
+		admin.GET("/reports/sellers", reportHandler.GetSellerRevenue)
+
+		admin.GET("/commission-rates", sellerHandler.GetCommissionRates)
+		admin.POST("/commission-rates", sellerHandler.CreateCommissionRate)
+		admin.DELETE("/commission-rates/:id", sellerHandler.DeleteCommissionRate)
+
+		admin.GET("/lockouts", userHandler.GetLockouts)
+		admin.DELETE("/lockouts/:id", userHandler.Unlock)
+
+		admin.GET("/warehouses", warehouseHandler.GetWarehouses)
+		admin.POST("/warehouses", warehouseHandler.CreateWarehouse)
+		admin.PUT("/warehouses/:id", warehouseHandler.UpdateWarehouse)
+		admin.DELETE("/warehouses/:id", warehouseHandler.DeleteWarehouse)
+
+		admin.GET("/abandoned-carts", cartHandler.GetAbandonedCarts)
+		admin.GET("/abandoned-carts/stats", cartHandler.GetAbandonedCartStats)
+
+		admin.GET("/trash/products", trashHandler.GetTrashedProducts)
+		admin.POST("/trash/products/:id/restore", trashHandler.RestoreProduct)
+		admin.GET("/trash/users", trashHandler.GetTrashedUsers)
+		admin.POST("/trash/users/:id/restore", trashHandler.RestoreUser)
 	}
 
 	fmt.Printf("E-Commerce API Server is running on port %s\n", cfg.ServerPort)
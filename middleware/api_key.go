@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+const apiKeyPrefix = "sk_"
+
+var scopePattern = regexp.MustCompile(`^[a-z-]+:(read|write)$`)
+
+// GenerateAPIKey returns a new plaintext key together with the lookup prefix
+// and hash that are stored. The plaintext is only ever shown once.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = apiKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidScope reports whether scope is "*" or has the form "<resource>:read"
+// or "<resource>:write", where resource is the first path segment of a route.
+func ValidScope(scope string) bool {
+	return scope == "*" || scopePattern.MatchString(scope)
+}
+
+// requiredScope derives the scope a request needs from its route, e.g.
+// GET /products/:id needs "products:read" and POST /cart needs "cart:write".
+func requiredScope(c *gin.Context) string {
+	path := strings.TrimPrefix(c.FullPath(), "/")
+	resource, _, _ := strings.Cut(path, "/")
+	resource = strings.TrimPrefix(resource, "my-")
+
+	action := "write"
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		action = "read"
+	}
+	return resource + ":" + action
+}
+
+func scopeAllowed(granted []string, required string) bool {
+	resource, action, _ := strings.Cut(required, ":")
+	for _, scope := range granted {
+		if scope == "*" || scope == required {
+			return true
+		}
+		if action == "read" && scope == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, key string) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, apiKeyPrefix) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := db.Preload("User").Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashAPIKey(key))) != 1 || apiKey.User.ID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key expired"})
+		c.Abort()
+		return
+	}
+
+	required := requiredScope(c)
+	if !scopeAllowed(apiKey.ScopeList(), required) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing scope " + required})
+		c.Abort()
+		return
+	}
+
+	db.Model(&apiKey).UpdateColumns(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"last_used_ip": c.ClientIP(),
+	})
+
+	c.Set("user_id", apiKey.User.ID)
+	c.Set("email", apiKey.User.Email)
+	c.Set("role", apiKey.User.Role)
+	c.Set("api_key_id", apiKey.ID)
+	c.Next()
+}
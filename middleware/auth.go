@@ -1,46 +1,60 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/hannanmiah/golang-tutorial/config"
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
 )
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID       uint   `json:"user_id"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	TokenVersion int    `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-var jwtSecret []byte
-
-func init() {
-	cfg := config.LoadConfig()
-	jwtSecret = []byte(cfg.JWTSecret)
-}
+// GenerateJWT signs a token for the user. Bumping the user's TokenVersion
+// revokes every token issued before.
+func GenerateJWT(userID uint, email, role string, tokenVersion int) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys are not configured")
+	}
 
-func GenerateJWT(userID uint, email, role string) (string, error) {
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:       userID,
+		Email:        email,
+		Role:         role,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    keys.issuer,
+			Audience:  jwt.ClaimStrings{keys.audience},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(keys.active.method, claims)
+	if keys.active.kid != "" {
+		token.Header["kid"] = keys.active.kid
+	}
+	return token.SignedString(keys.active.signKey)
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, db, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -55,10 +69,19 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if keys == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication is not configured"})
+			c.Abort()
+			return
+		}
+
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc,
+			jwt.WithValidMethods(keys.validMethods()),
+			jwt.WithIssuer(keys.issuer),
+			jwt.WithAudience(keys.audience),
+			jwt.WithExpirationRequired(),
+		)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -66,9 +89,17 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
+		var user models.User
+		if err := db.Select("id", "email", "role", "token_version").
+			First(&user, claims.UserID).Error; err != nil || user.TokenVersion != claims.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("email", user.Email)
+		c.Set("role", user.Role)
 		c.Next()
 	}
 }
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CartTokenHeader carries the signed token that identifies a guest's cart.
+const CartTokenHeader = "X-Cart-Token"
+
+var cartSecret []byte
+
+// NewCartToken returns a new guest ID and the signed token handed to the
+// guest for it.
+func NewCartToken() (guestID, token string, err error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	guestID = hex.EncodeToString(raw)
+	return guestID, guestID + "." + signCartToken(guestID), nil
+}
+
+// ParseCartToken returns the guest ID of a cart token if its signature is
+// valid.
+func ParseCartToken(token string) (string, bool) {
+	guestID, signature, ok := strings.Cut(token, ".")
+	if !ok || guestID == "" || len(cartSecret) == 0 {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(signCartToken(guestID))) {
+		return "", false
+	}
+	return guestID, true
+}
+
+func signCartToken(guestID string) string {
+	mac := hmac.New(sha256.New, cartSecret)
+	mac.Write([]byte("cart:" + guestID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// OptionalAuthMiddleware authenticates requests that carry a JWT or API key
+// exactly like AuthMiddleware. Other requests go through as a guest, with
+// "guest_id" set when they send a valid cart token.
+func OptionalAuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	auth := AuthMiddleware(db)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != "" {
+			auth(c)
+			return
+		}
+
+		if guestID, ok := ParseCartToken(c.GetHeader(CartTokenHeader)); ok {
+			c.Set("guest_id", guestID)
+		}
+		c.Next()
+	}
+}
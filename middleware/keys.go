@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hannanmiah/golang-tutorial/config"
+)
+
+// signingKey is one entry of the key set. Keys loaded from a public key file
+// can only verify tokens; they stay around after rotation until every token
+// they signed has expired.
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+type keySet struct {
+	active   *signingKey
+	keys     map[string]*signingKey
+	issuer   string
+	audience string
+}
+
+var keys *keySet
+
+// Setup loads the JWT signing keys. With JWT_ALGORITHM=HS256 the shared
+// JWT_SECRET is used; with RS256 or EdDSA every "<kid>.pem" private key and
+// "<kid>.pub.pem" public key in JWT_KEYS_DIR is loaded and JWT_ACTIVE_KID (or
+// the lexically last private key) signs new tokens. It also sets the secret
+// guest cart tokens are signed with.
+func Setup(cfg *config.Config) error {
+	set := &keySet{
+		keys:     make(map[string]*signingKey),
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
+	}
+
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		key := &signingKey{
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(cfg.JWTSecret),
+			verifyKey: []byte(cfg.JWTSecret),
+		}
+		set.keys[""] = key
+		set.active = key
+	case "RS256", "EdDSA":
+		if err := set.loadDir(cfg.JWTKeysDir); err != nil {
+			return err
+		}
+		active, err := set.pickActive(cfg.JWTActiveKeyID)
+		if err != nil {
+			return err
+		}
+		if active.method.Alg() != cfg.JWTAlgorithm {
+			return fmt.Errorf("active key %q is %s, expected %s", active.kid, active.method.Alg(), cfg.JWTAlgorithm)
+		}
+		set.active = active
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWTAlgorithm)
+	}
+
+	keys = set
+	cartSecret = []byte(cfg.CartTokenSecret)
+	return nil
+}
+
+func (s *keySet) loadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read JWT keys directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		var key *signingKey
+		if kid, ok := strings.CutSuffix(name, ".pub.pem"); ok {
+			key, err = parsePublicKey(kid, data)
+		} else {
+			key, err = parsePrivateKey(strings.TrimSuffix(name, ".pem"), data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load key %s: %w", name, err)
+		}
+		if _, exists := s.keys[key.kid]; exists && key.signKey == nil {
+			continue
+		}
+		s.keys[key.kid] = key
+	}
+
+	if len(s.keys) == 0 {
+		return fmt.Errorf("no keys found in %s", dir)
+	}
+	return nil
+}
+
+func (s *keySet) pickActive(kid string) (*signingKey, error) {
+	if kid != "" {
+		key, ok := s.keys[kid]
+		if !ok || key.signKey == nil {
+			return nil, fmt.Errorf("active key %q has no private key", kid)
+		}
+		return key, nil
+	}
+
+	var kids []string
+	for kid, key := range s.keys {
+		if key.signKey != nil {
+			kids = append(kids, kid)
+		}
+	}
+	if len(kids) == 0 {
+		return nil, errors.New("no private key available for signing")
+	}
+	sort.Strings(kids)
+	return s.keys[kids[len(kids)-1]], nil
+}
+
+func parsePrivateKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}, nil
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+}
+
+func parsePublicKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, verifyKey: key}, nil
+	case ed25519.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, verifyKey: key}, nil
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+}
+
+func (s *keySet) validMethods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range s.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+func (s *keySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSHandler publishes the public halves of the asymmetric keys so other
+// services can verify our tokens. Shared HS256 secrets are never exposed.
+func JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jwks := []JWK{}
+		if keys != nil {
+			for _, key := range keys.keys {
+				if jwk, ok := key.jwk(); ok {
+					jwks = append(jwks, jwk)
+				}
+			}
+		}
+		sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, gin.H{"keys": jwks})
+	}
+}
+
+func (k *signingKey) jwk() (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.kid,
+			Alg: k.method.Alg(),
+			Use: "sig",
+			N:   encode(pub.N.Bytes()),
+			E:   encode(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.kid,
+			Alg: k.method.Alg(),
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   encode(pub),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -14,6 +18,11 @@ type User struct {
 	Products  []Product `gorm:"foreignKey:OwnerID" json:"products,omitempty"`
 	Orders    []Order `gorm:"foreignKey:UserID" json:"orders,omitempty"`
 	Carts     []Cart `gorm:"foreignKey:UserID" json:"carts,omitempty"`
+
+	PendingEmail               string     `json:"pending_email,omitempty"`
+	EmailVerificationHash      string     `gorm:"index" json:"-"`
+	EmailVerificationExpiresAt *time.Time `json:"-"`
+	TokenVersion               int        `gorm:"default:0" json:"-"`
 }
 
 type Product struct {
@@ -26,6 +35,22 @@ type Product struct {
 	Owner       User    `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
 	CartItems   []Cart  `gorm:"foreignKey:ProductID" json:"cart_items,omitempty"`
 	OrderItems  []OrderItem `gorm:"foreignKey:ProductID" json:"order_items,omitempty"`
+
+	Category string `gorm:"index" json:"category"`
+	SKU      string `gorm:"index" json:"sku"`
+
+	Status      string     `gorm:"default:published;index" json:"status"`
+	PublishAt   *time.Time `gorm:"index" json:"publish_at"`
+	UnpublishAt *time.Time `gorm:"index" json:"unpublish_at"`
+
+	LowStockThreshold  int        `gorm:"default:0" json:"low_stock_threshold"`
+	LowStockNotifiedAt *time.Time `json:"low_stock_notified_at"`
+
+	CompareAtPrice *float64   `json:"compare_at_price"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at"`
+
+	OnHand    *int `gorm:"-" json:"on_hand,omitempty"`
+	Available *int `gorm:"-" json:"available,omitempty"`
 }
 
 type Order struct {
@@ -35,6 +60,18 @@ type Order struct {
 	Status     string      `gorm:"default:pending" json:"status"`
 	Total      float64     `gorm:"not null" json:"total"`
 	OrderItems []OrderItem `gorm:"foreignKey:OrderID" json:"order_items,omitempty"`
+
+	SellerOrders []SellerOrder `gorm:"foreignKey:OrderID" json:"seller_orders,omitempty"`
+	PaidAt       *time.Time    `json:"paid_at"`
+
+	ShippingAddress   string   `json:"shipping_address"`
+	ShippingLatitude  *float64 `json:"shipping_latitude"`
+	ShippingLongitude *float64 `json:"shipping_longitude"`
+
+	InvoiceNumber *string    `gorm:"uniqueIndex" json:"invoice_number"`
+	InvoicedAt    *time.Time `json:"invoiced_at"`
+
+	Shipments []Shipment `gorm:"foreignKey:OrderID" json:"shipments,omitempty"`
 }
 
 type OrderItem struct {
@@ -45,13 +82,343 @@ type OrderItem struct {
 	Product   Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	Quantity  int     `gorm:"not null" json:"quantity"`
 	Price     float64 `gorm:"not null" json:"price"`
+
+	SellerID      uint  `gorm:"index" json:"seller_id"`
+	SellerOrderID *uint `gorm:"index" json:"seller_order_id"`
 }
 
+// Cart is one line of a shopping cart. Guest carts have no user (UserID is
+// 0) and are identified by GuestID instead.
 type Cart struct {
 	gorm.Model
-	UserID    uint    `gorm:"not null" json:"user_id"`
+	UserID    uint    `gorm:"not null;index" json:"user_id"`
+	GuestID   string  `gorm:"index" json:"-"`
 	User      User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	ProductID uint    `gorm:"not null" json:"product_id"`
 	Product   Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	Quantity  int     `gorm:"default:1" json:"quantity"`
+
+	PriceAtAdd float64 `json:"price_at_add"`
+}
+
+type LoginThrottle struct {
+	gorm.Model
+	Scope          string     `gorm:"uniqueIndex:idx_login_throttle_key;not null" json:"scope"`
+	Identifier     string     `gorm:"uniqueIndex:idx_login_throttle_key;not null" json:"identifier"`
+	FailedAttempts int        `gorm:"default:0" json:"failed_attempts"`
+	LastFailedAt   *time.Time `json:"last_failed_at"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+type APIKey struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"uniqueIndex;not null" json:"prefix"`
+	KeyHash    string     `gorm:"not null" json:"-"`
+	Scopes     string     `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+}
+
+// ScopeList returns the comma separated Scopes as a slice. An empty list
+// grants nothing.
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+type DataExport struct {
+	gorm.Model
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Status      string     `gorm:"default:pending" json:"status"`
+	TokenHash   string     `gorm:"column:token;uniqueIndex;not null" json:"-"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type SellerProfile struct {
+	gorm.Model
+	UserID       uint   `gorm:"uniqueIndex;not null" json:"user_id"`
+	User         User   `gorm:"foreignKey:UserID" json:"-"`
+	StoreName    string `gorm:"not null" json:"store_name"`
+	Description  string `json:"description"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// SellerOrder is the part of an order fulfilled by a single seller, so each
+// seller can ship independently.
+type SellerOrder struct {
+	gorm.Model
+	OrderID    uint        `gorm:"not null;index" json:"order_id"`
+	Order      Order       `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	SellerID   uint        `gorm:"not null;index" json:"seller_id"`
+	Status     string      `gorm:"default:pending" json:"status"`
+	Subtotal   float64     `gorm:"not null" json:"subtotal"`
+	OrderItems []OrderItem `gorm:"foreignKey:SellerOrderID" json:"order_items,omitempty"`
+	Shipments  []Shipment  `gorm:"foreignKey:SellerOrderID" json:"shipments,omitempty"`
+}
+
+// CommissionRate overrides the default platform commission for a seller, a
+// product category, or a seller's products in one category.
+type CommissionRate struct {
+	gorm.Model
+	SellerID *uint   `gorm:"index" json:"seller_id"`
+	Category string  `gorm:"index" json:"category"`
+	Percent  float64 `gorm:"not null" json:"percent"`
+}
+
+// LedgerTransaction groups balanced double-entry LedgerEntry rows.
+type LedgerTransaction struct {
+	gorm.Model
+	Kind          string        `gorm:"not null;index" json:"kind"`
+	OrderID       *uint         `gorm:"index" json:"order_id"`
+	SellerOrderID *uint         `gorm:"index" json:"seller_order_id"`
+	PayoutID      *uint         `gorm:"index" json:"payout_id"`
+	Memo          string        `json:"memo"`
+	Entries       []LedgerEntry `gorm:"foreignKey:TransactionID" json:"entries,omitempty"`
+}
+
+type LedgerEntry struct {
+	ID            uint              `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time         `json:"created_at"`
+	TransactionID uint              `gorm:"not null;index" json:"transaction_id"`
+	Transaction   LedgerTransaction `gorm:"foreignKey:TransactionID" json:"-"`
+	Account       string            `gorm:"not null;index" json:"account"`
+	SellerID      *uint             `gorm:"index" json:"seller_id"`
+	Debit         float64           `gorm:"default:0" json:"debit"`
+	Credit        float64           `gorm:"default:0" json:"credit"`
+}
+
+type Payout struct {
+	gorm.Model
+	SellerID uint    `gorm:"not null;index" json:"seller_id"`
+	Amount   float64 `gorm:"not null" json:"amount"`
+	Batch    string  `gorm:"not null;index" json:"batch"`
+}
+
+// Reservation holds stock for a shopper while they check out, or for an order
+// until it is paid. Active reservations reduce a product's available stock.
+type Reservation struct {
+	gorm.Model
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	ProductID   uint      `gorm:"not null;index" json:"product_id"`
+	Quantity    int       `gorm:"not null" json:"quantity"`
+	Status      string    `gorm:"default:active;index" json:"status"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
+	OrderID     *uint     `gorm:"index" json:"order_id"`
+	OrderItemID *uint     `gorm:"index" json:"order_item_id"`
+}
+
+type Warehouse struct {
+	gorm.Model
+	Name      string  `gorm:"not null" json:"name"`
+	Code      string  `gorm:"uniqueIndex;not null" json:"code"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Active    bool    `gorm:"default:true" json:"active"`
+}
+
+// StockLevel is the quantity of a product held in one warehouse. A product's
+// Stock is the total across its warehouses plus any stock not yet assigned to
+// a warehouse.
+type StockLevel struct {
+	gorm.Model
+	WarehouseID uint      `gorm:"not null;uniqueIndex:idx_stock_level" json:"warehouse_id"`
+	Warehouse   Warehouse `gorm:"foreignKey:WarehouseID" json:"warehouse,omitempty"`
+	ProductID   uint      `gorm:"not null;uniqueIndex:idx_stock_level" json:"product_id"`
+	Quantity    int       `gorm:"not null;default:0" json:"quantity"`
+}
+
+// StockAllocation records which warehouse an order item ships from.
+type StockAllocation struct {
+	gorm.Model
+	OrderItemID uint `gorm:"not null;index" json:"order_item_id"`
+	WarehouseID uint `gorm:"not null;index" json:"warehouse_id"`
+	Quantity    int  `gorm:"not null" json:"quantity"`
+}
+
+var ErrImmutable = errors.New("record cannot be changed once written")
+
+// StockMovement is one entry of the append-only stock ledger. Summing the
+// deltas of a product gives its stock; summing those of a product in one
+// warehouse gives its stock level there.
+type StockMovement struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+	ProductID   uint      `gorm:"not null;index" json:"product_id"`
+	WarehouseID *uint     `gorm:"index" json:"warehouse_id"`
+	Delta       int       `gorm:"not null" json:"delta"`
+	Type        string    `gorm:"not null;index" json:"type"`
+	Reason      string    `json:"reason"`
+	Note        string    `json:"note"`
+	ActorID     *uint     `gorm:"index" json:"actor_id"`
+	OrderID     *uint     `gorm:"index" json:"order_id"`
+}
+
+func (m *StockMovement) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+func (m *StockMovement) BeforeDelete(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+// StockSubscription asks for a user to be told when an out-of-stock product
+// is available again.
+type StockSubscription struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;uniqueIndex:idx_stock_subscription" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	ProductID  uint       `gorm:"not null;uniqueIndex:idx_stock_subscription" json:"product_id"`
+	Product    Product    `gorm:"foreignKey:ProductID" json:"-"`
+	NotifiedAt *time.Time `gorm:"index" json:"notified_at"`
+}
+
+// ProductImport is a CSV upload of products and its row-by-row report.
+type ProductImport struct {
+	gorm.Model
+	UserID      uint               `gorm:"not null;index" json:"user_id"`
+	Filename    string             `json:"filename"`
+	Status      string             `gorm:"default:pending" json:"status"`
+	DryRun      bool               `json:"dry_run"`
+	TotalRows   int                `json:"total_rows"`
+	Created     int                `json:"created"`
+	Updated     int                `json:"updated"`
+	Failed      int                `json:"failed"`
+	Error       string             `json:"error,omitempty"`
+	CompletedAt *time.Time         `json:"completed_at"`
+	Rows        []ProductImportRow `gorm:"serializer:json;type:text" json:"rows,omitempty"`
+}
+
+// ProductImportRow is the outcome of one CSV row of a ProductImport.
+type ProductImportRow struct {
+	Row       int    `json:"row"`
+	SKU       string `json:"sku,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Action    string `json:"action"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PriceChange records a change to a product's price and what caused it.
+type PriceChange struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	ProductID        uint      `gorm:"not null;index" json:"product_id"`
+	OldPrice         float64   `json:"old_price"`
+	NewPrice         float64   `gorm:"not null" json:"new_price"`
+	Reason           string    `gorm:"not null" json:"reason"`
+	ActorID          *uint     `gorm:"index" json:"actor_id"`
+	ScheduledPriceID *uint     `gorm:"index" json:"scheduled_price_id"`
+}
+
+func (m *PriceChange) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+func (m *PriceChange) BeforeDelete(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+// ScheduledPrice is a future price for a product. Without an end it replaces
+// the price for good; with one it is a sale, after which the regular price
+// comes back.
+type ScheduledPrice struct {
+	gorm.Model
+	ProductID   uint       `gorm:"not null;index" json:"product_id"`
+	Price       float64    `gorm:"not null" json:"price"`
+	StartsAt    time.Time  `gorm:"not null;index" json:"starts_at"`
+	EndsAt      *time.Time `gorm:"index" json:"ends_at"`
+	Status      string     `gorm:"default:pending;index" json:"status"`
+	CreatedByID uint       `gorm:"not null" json:"created_by_id"`
+}
+
+// Wishlist is a named list of products a user wants to keep. It can be
+// shared read-only through its ShareToken. Each user has at most one
+// SavedForLater list, which holds items moved out of the cart.
+type Wishlist struct {
+	gorm.Model
+	UserID        uint           `gorm:"not null;index" json:"user_id"`
+	User          User           `gorm:"foreignKey:UserID" json:"-"`
+	Name          string         `gorm:"not null" json:"name"`
+	SavedForLater bool           `gorm:"default:false" json:"saved_for_later"`
+	ShareToken    *string        `gorm:"uniqueIndex" json:"share_token,omitempty"`
+	Items         []WishlistItem `gorm:"foreignKey:WishlistID" json:"items,omitempty"`
+}
+
+type WishlistItem struct {
+	gorm.Model
+	WishlistID uint    `gorm:"not null;index" json:"wishlist_id"`
+	ProductID  uint    `gorm:"not null;index" json:"product_id"`
+	Product    Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity   int     `gorm:"default:1" json:"quantity"`
+	Note       string  `json:"note"`
+}
+
+// AbandonedCart tracks a cart left untouched since LastActivityAt, the
+// reminders sent about it and how it ended. Guest carts have no user and
+// are identified by GuestID.
+type AbandonedCart struct {
+	gorm.Model
+	UserID         uint       `gorm:"index" json:"user_id"`
+	GuestID        string     `gorm:"index" json:"-"`
+	LastActivityAt time.Time  `gorm:"not null" json:"last_activity_at"`
+	Items          int        `json:"items"`
+	Value          float64    `json:"value"`
+	RemindersSent  int        `gorm:"default:0" json:"reminders_sent"`
+	LastRemindedAt *time.Time `json:"last_reminded_at"`
+	Status         string     `gorm:"default:open;index" json:"status"`
+	ClosedAt       *time.Time `json:"closed_at"`
+}
+
+// Sequence is a named counter that hands out numbers without gaps. It is
+// only ever incremented inside the transaction that uses the number, so a
+// rolled back transaction gives its number back.
+type Sequence struct {
+	Name  string `gorm:"primaryKey" json:"name"`
+	Value uint   `gorm:"not null" json:"value"`
+}
+
+// Shipment is a parcel sent for part or all of one seller's share of an
+// order.
+type Shipment struct {
+	gorm.Model
+	OrderID        uint           `gorm:"not null;index" json:"order_id"`
+	SellerOrderID  uint           `gorm:"not null;index" json:"seller_order_id"`
+	Carrier        string         `gorm:"not null" json:"carrier"`
+	TrackingNumber string         `gorm:"not null;index" json:"tracking_number"`
+	Status         string         `gorm:"default:shipped" json:"status"`
+	ShippedAt      time.Time      `json:"shipped_at"`
+	InTransitAt    *time.Time     `json:"in_transit_at"`
+	DeliveredAt    *time.Time     `json:"delivered_at"`
+	CreatedByID    uint           `json:"created_by_id"`
+	Items          []ShipmentItem `gorm:"foreignKey:ShipmentID" json:"items,omitempty"`
+}
+
+// ShipmentItem is how many units of an order item went out in a shipment.
+type ShipmentItem struct {
+	gorm.Model
+	ShipmentID  uint `gorm:"not null;index" json:"shipment_id"`
+	OrderItemID uint `gorm:"not null;index" json:"order_item_id"`
+	Quantity    int  `gorm:"not null" json:"quantity"`
+}
+
+// DailySalesRollup holds the sales of one day, summed up ahead of time so
+// revenue reports do not have to scan every order. Date is the local
+// calendar day, as 2006-01-02.
+type DailySalesRollup struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Date      string    `gorm:"uniqueIndex;not null" json:"date"`
+	Orders    int       `json:"orders"`
+	Items     int       `json:"items"`
+	Revenue   float64   `json:"revenue"`
 }
\ No newline at end of file
@@ -0,0 +1,27 @@
+package notify
+
+import "log"
+
+// Message is a notification addressed to a user's email address.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// LogNotifier writes notifications to the application log. It stands in for
+// an email provider during development.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Send(msg Message) error {
+	log.Printf("Notification to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,60 @@
+package orders
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+const invoiceSequence = "invoice"
+
+// nextNumber takes the next number of a sequence. The counter is bumped
+// before it is read so that concurrent transactions queue on the write lock
+// instead of reading the same value.
+func nextNumber(tx *gorm.DB, name string) (uint, error) {
+	result := tx.Model(&models.Sequence{}).Where("name = ?", name).
+		Update("value", gorm.Expr("value + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := tx.Create(&models.Sequence{Name: name, Value: 1}).Error; err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	var sequence models.Sequence
+	if err := tx.First(&sequence, "name = ?", name).Error; err != nil {
+		return 0, err
+	}
+	return sequence.Value, nil
+}
+
+// AssignInvoiceNumber gives a paid order the next invoice number. It must run
+// in the same transaction that marks the order paid, so numbers stay
+// sequential with no gaps. Orders that already have one keep it.
+func AssignInvoiceNumber(tx *gorm.DB, order *models.Order) error {
+	if order.InvoiceNumber != nil {
+		return nil
+	}
+
+	n, err := nextNumber(tx, invoiceSequence)
+	if err != nil {
+		return err
+	}
+	number := fmt.Sprintf("INV-%06d", n)
+	now := time.Now()
+	if err := tx.Model(order).Updates(map[string]interface{}{
+		"invoice_number": number,
+		"invoiced_at":    now,
+	}).Error; err != nil {
+		return err
+	}
+	order.InvoiceNumber = &number
+	order.InvoicedAt = &now
+	return nil
+}
@@ -0,0 +1,111 @@
+package orders
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/testdb"
+)
+
+func TestNextNumber(t *testing.T) {
+	errRollback := errors.New("rollback")
+
+	// A step takes the next number of a sequence, then commits or rolls back.
+	type step struct {
+		sequence string
+		rollback bool
+		want     uint
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "counts up from one",
+			steps: []step{
+				{"invoice", false, 1},
+				{"invoice", false, 2},
+				{"invoice", false, 3},
+			},
+		},
+		{
+			name: "sequences are independent",
+			steps: []step{
+				{"invoice", false, 1},
+				{"credit", false, 1},
+				{"invoice", false, 2},
+				{"credit", false, 2},
+			},
+		},
+		{
+			name: "rolled back numbers are taken again",
+			steps: []step{
+				{"invoice", true, 1},
+				{"invoice", false, 1},
+				{"invoice", true, 2},
+				{"invoice", true, 2},
+				{"invoice", false, 2},
+				{"invoice", false, 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.Open(t, &models.Sequence{})
+			for i, step := range tt.steps {
+				var got uint
+				err := db.Transaction(func(tx *gorm.DB) error {
+					n, err := nextNumber(tx, step.sequence)
+					if err != nil {
+						return err
+					}
+					got = n
+					if step.rollback {
+						return errRollback
+					}
+					return nil
+				})
+				if err != nil && !(step.rollback && errors.Is(err, errRollback)) {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if got != step.want {
+					t.Errorf("step %d: %s number = %d, want %d", i, step.sequence, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPaidOrderGetsInvoiceNumber(t *testing.T) {
+	db := newTestDB(t)
+	first, _ := newTestOrder(t, db, 1)
+	if err := setStatus(t, db, first, "paid"); err != nil {
+		t.Fatal(err)
+	}
+	db.First(first, first.ID)
+	if first.InvoiceNumber == nil || *first.InvoiceNumber != "INV-000001" {
+		t.Fatalf("invoice number = %v, want INV-000001", first.InvoiceNumber)
+	}
+
+	// Assigning again keeps the number instead of taking a new one.
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return AssignInvoiceNumber(tx, first)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var n uint
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		n, err = nextNumber(tx, invoiceSequence)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("next invoice number = %d, want 2", n)
+	}
+}
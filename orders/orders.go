@@ -0,0 +1,371 @@
+package orders
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/inventory"
+	"github.com/hannanmiah/golang-tutorial/ledger"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/reports"
+)
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// terminal statuses cannot be changed once reached.
+var terminal = map[string]bool{
+	"delivered": true,
+	"cancelled": true,
+}
+
+// statusSteps orders the statuses an order moves forward through.
+// Cancelling is possible from any of them until the order is delivered.
+var statusSteps = map[string]int{
+	"pending":    0,
+	"paid":       1,
+	"processing": 2,
+	"shipped":    3,
+	"delivered":  4,
+}
+
+// checkTransition rejects status changes an order or sub-order cannot make.
+// Orders only move forward, and a pending order can only be paid or
+// cancelled, so nothing moves on without its stock being deducted and its
+// sellers credited.
+func checkTransition(from, to string) error {
+	switch {
+	case terminal[from]:
+		return ErrInvalidTransition
+	case to == "cancelled":
+		return nil
+	case statusSteps[to] <= statusSteps[from]:
+		return ErrInvalidTransition
+	case from == "pending" && to != "paid":
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+// CreateSellerOrders splits a freshly created order into one sub-order per
+// seller and links each order item to its sub-order.
+func CreateSellerOrders(tx *gorm.DB, order *models.Order) error {
+	groups := make(map[uint][]*models.OrderItem)
+	var sellers []uint
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		if _, ok := groups[item.SellerID]; !ok {
+			sellers = append(sellers, item.SellerID)
+		}
+		groups[item.SellerID] = append(groups[item.SellerID], item)
+	}
+	sort.Slice(sellers, func(i, j int) bool { return sellers[i] < sellers[j] })
+
+	for _, sellerID := range sellers {
+		var subtotal float64
+		for _, item := range groups[sellerID] {
+			subtotal += float64(item.Quantity) * item.Price
+		}
+
+		sellerOrder := models.SellerOrder{
+			OrderID:  order.ID,
+			SellerID: sellerID,
+			Status:   order.Status,
+			Subtotal: subtotal,
+		}
+		if err := tx.Create(&sellerOrder).Error; err != nil {
+			return err
+		}
+
+		for _, item := range groups[sellerID] {
+			item.SellerOrderID = &sellerOrder.ID
+			if err := tx.Model(item).Update("seller_order_id", sellerOrder.ID).Error; err != nil {
+				return err
+			}
+		}
+		order.SellerOrders = append(order.SellerOrders, sellerOrder)
+	}
+	return nil
+}
+
+// SetStatus changes the status of a whole order, cascading it to every
+// sub-order that has not already finished. Paying an order turns its stock
+// reservations into deductions, credits its sellers in the ledger and
+// issues its invoice number; cancelling a paid order refunds them, until it
+// ships restocks it, and takes it out of its day's sales rollup. Stock
+// movements are recorded as made by actorID, or by the system when nil.
+func SetStatus(tx *gorm.DB, order *models.Order, actorID *uint, status string) error {
+	if err := checkTransition(order.Status, status); err != nil {
+		return err
+	}
+
+	if status == "paid" {
+		if err := inventory.ConvertOrder(tx, order, actorID); err != nil {
+			return err
+		}
+	}
+
+	var sellerOrders []models.SellerOrder
+	if err := tx.Where("order_id = ? AND status NOT IN ?", order.ID, []string{"delivered", "cancelled"}).
+		Find(&sellerOrders).Error; err != nil {
+		return err
+	}
+	for i := range sellerOrders {
+		// Sub-orders a seller has already taken further are left alone.
+		if status != "cancelled" && statusSteps[sellerOrders[i].Status] >= statusSteps[status] {
+			continue
+		}
+		if err := applySellerOrderStatus(tx, &sellerOrders[i], actorID, status); err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if status == "paid" {
+		updates["paid_at"] = time.Now()
+
+		// Sub-orders cancelled while the order was pending are not charged.
+		var cancelled float64
+		if err := tx.Model(&models.SellerOrder{}).
+			Where("order_id = ? AND status = ?", order.ID, "cancelled").
+			Select("COALESCE(SUM(subtotal), 0)").
+			Scan(&cancelled).Error; err != nil {
+			return err
+		}
+		if cancelled > 0 {
+			updates["total"] = math.Round((order.Total-cancelled)*100) / 100
+		}
+		if err := AssignInvoiceNumber(tx, order); err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(order).Updates(updates).Error; err != nil {
+		return err
+	}
+	if status == "cancelled" && order.PaidAt != nil {
+		return reports.RollupDay(tx, *order.PaidAt)
+	}
+	return nil
+}
+
+// SetSellerOrderStatus changes the status of one seller's part of an order and
+// then derives the parent order's status from all of its sub-orders.
+// Cancelling a sub-order of a paid order takes it out of its day's sales
+// rollup. Stock movements are recorded as made by actorID, or by the system
+// when nil.
+func SetSellerOrderStatus(tx *gorm.DB, sellerOrder *models.SellerOrder, actorID *uint, status string) error {
+	if err := checkTransition(sellerOrder.Status, status); err != nil {
+		return err
+	}
+
+	if err := applySellerOrderStatus(tx, sellerOrder, actorID, status); err != nil {
+		return err
+	}
+	if err := SyncStatus(tx, sellerOrder.OrderID); err != nil {
+		return err
+	}
+	if status != "cancelled" {
+		return nil
+	}
+	var order models.Order
+	if err := tx.Select("id", "paid_at").First(&order, sellerOrder.OrderID).Error; err != nil {
+		return err
+	}
+	if order.PaidAt != nil {
+		return reports.RollupDay(tx, *order.PaidAt)
+	}
+	return nil
+}
+
+func applySellerOrderStatus(tx *gorm.DB, sellerOrder *models.SellerOrder, actorID *uint, status string) error {
+	previous := sellerOrder.Status
+	if status == "cancelled" {
+		// Items that have gone out cannot be restocked by cancelling.
+		var shipments int64
+		if err := tx.Model(&models.Shipment{}).Where("seller_order_id = ?", sellerOrder.ID).Count(&shipments).Error; err != nil {
+			return err
+		}
+		if shipments > 0 {
+			return ErrShipped
+		}
+	}
+	if err := tx.Model(sellerOrder).Update("status", status).Error; err != nil {
+		return err
+	}
+
+	switch status {
+	case "paid":
+		return ledger.RecordSale(tx, sellerOrder)
+	case "cancelled":
+		// Only stock that was deducted on payment goes back; an order that
+		// was never paid just gives up its holds.
+		var order models.Order
+		if err := tx.Select("id", "paid_at").First(&order, sellerOrder.OrderID).Error; err != nil {
+			return err
+		}
+		switch {
+		case order.PaidAt == nil:
+			if err := releaseSellerOrder(tx, sellerOrder); err != nil {
+				return err
+			}
+		case previous == "paid" || previous == "processing":
+			if err := restockSellerOrder(tx, sellerOrder, actorID); err != nil {
+				return err
+			}
+		}
+		return ledger.RecordRefund(tx, sellerOrder)
+	}
+	return nil
+}
+
+// releaseSellerOrder drops the stock held for an unpaid sub-order's items.
+func releaseSellerOrder(tx *gorm.DB, sellerOrder *models.SellerOrder) error {
+	var itemIDs []uint
+	if err := tx.Model(&models.OrderItem{}).
+		Where("seller_order_id = ?", sellerOrder.ID).
+		Pluck("id", &itemIDs).Error; err != nil {
+		return err
+	}
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	return inventory.ReleaseOrderItems(tx, itemIDs)
+}
+
+// restockSellerOrder puts the stock of a paid sub-order that was cancelled
+// before shipping back on sale.
+func restockSellerOrder(tx *gorm.DB, sellerOrder *models.SellerOrder, actorID *uint) error {
+	var items []models.OrderItem
+	if err := tx.Where("seller_order_id = ?", sellerOrder.ID).Find(&items).Error; err != nil {
+		return err
+	}
+	return inventory.Restock(tx, sellerOrder.OrderID, items, actorID)
+}
+
+// ExpireUnpaid cancels pending orders whose stock reservations have run out,
+// so the stock they held goes back on sale.
+func ExpireUnpaid(db *gorm.DB) (int, error) {
+	var orderList []models.Order
+	if err := db.Where("status = ? AND id IN (?)", "pending",
+		db.Model(&models.Reservation{}).
+			Select("order_id").
+			Where("status = ? AND expires_at <= ? AND order_id IS NOT NULL", "active", time.Now())).
+		Find(&orderList).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range orderList {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return SetStatus(tx, &orderList[i], nil, "cancelled")
+		}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// SweepReservations releases lapsed cart and checkout holds and cancels the
+// orders that were not paid in time.
+func SweepReservations(db *gorm.DB) error {
+	released, err := inventory.ReleaseExpired(db)
+	if err != nil {
+		return err
+	}
+	cancelled, err := ExpireUnpaid(db)
+	if err != nil {
+		return err
+	}
+	if released > 0 || cancelled > 0 {
+		log.Printf("Released %d expired reservations and cancelled %d unpaid orders", released, cancelled)
+	}
+	return nil
+}
+
+// SyncStatus sets an order's status from its sub-orders: cancelled once all of
+// them are cancelled, delivered or shipped once every remaining one is, and
+// processing as soon as any seller has started on theirs.
+func SyncStatus(tx *gorm.DB, orderID uint) error {
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return err
+	}
+
+	var sellerOrders []models.SellerOrder
+	if err := tx.Where("order_id = ?", orderID).Find(&sellerOrders).Error; err != nil {
+		return err
+	}
+	if len(sellerOrders) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, sellerOrder := range sellerOrders {
+		counts[sellerOrder.Status]++
+	}
+	active := len(sellerOrders) - counts["cancelled"]
+
+	status := order.Status
+	switch {
+	case active == 0:
+		status = "cancelled"
+	case counts["delivered"] == active:
+		status = "delivered"
+	case counts["shipped"]+counts["delivered"] == active:
+		status = "shipped"
+	case counts["processing"]+counts["shipped"]+counts["delivered"] > 0:
+		status = "processing"
+	}
+
+	if status == order.Status {
+		return nil
+	}
+	return tx.Model(&order).Update("status", status).Error
+}
+
+// BackfillSellerOrders creates sub-orders for orders placed before orders
+// were split by seller, using each product's owner as the seller.
+func BackfillSellerOrders(db *gorm.DB) (int, error) {
+	var orderList []models.Order
+	if err := db.Where("id NOT IN (?)", db.Model(&models.SellerOrder{}).Select("order_id")).
+		Preload("OrderItems").
+		Find(&orderList).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range orderList {
+		order := &orderList[i]
+		if len(order.OrderItems) == 0 {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for j := range order.OrderItems {
+				item := &order.OrderItems[j]
+				if item.SellerID != 0 {
+					continue
+				}
+				var product models.Product
+				if err := tx.Unscoped().First(&product, item.ProductID).Error; err != nil {
+					return err
+				}
+				item.SellerID = product.OwnerID
+				if err := tx.Model(item).Update("seller_id", product.OwnerID).Error; err != nil {
+					return err
+				}
+			}
+			return CreateSellerOrders(tx, order)
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,515 @@
+package orders
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/documents"
+	"github.com/hannanmiah/golang-tutorial/ledger"
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/reports"
+	"github.com/hannanmiah/golang-tutorial/testdb"
+)
+
+// lifecycleModels are the tables a change of order status reads and writes:
+// stock and its holds, the seller ledger, invoice numbers, shipments and
+// sales rollups.
+var lifecycleModels = []interface{}{
+	&models.User{},
+	&models.Product{},
+	&models.Order{},
+	&models.OrderItem{},
+	&models.SellerOrder{},
+	&models.CommissionRate{},
+	&models.LedgerTransaction{},
+	&models.LedgerEntry{},
+	&models.Reservation{},
+	&models.Warehouse{},
+	&models.StockLevel{},
+	&models.StockAllocation{},
+	&models.StockMovement{},
+	&models.Sequence{},
+	&models.Shipment{},
+	&models.ShipmentItem{},
+	&models.DailySalesRollup{},
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	return testdb.Open(t, lifecycleModels...)
+}
+
+// newTestOrder places a pending order for quantity units of a product with
+// 10 in stock, split into its seller's sub-order.
+func newTestOrder(t *testing.T, db *gorm.DB, quantity int) (*models.Order, *models.Product) {
+	t.Helper()
+	seller := testdb.User(t, db, "seller@example.com")
+	buyer := testdb.User(t, db, "buyer@example.com")
+	product := testdb.Product(t, db, seller.ID, "Mug", 5, 10)
+
+	order := models.Order{
+		UserID: buyer.ID,
+		Status: "pending",
+		Total:  product.Price * float64(quantity),
+		OrderItems: []models.OrderItem{
+			{ProductID: product.ID, Quantity: quantity, Price: product.Price, SellerID: seller.ID},
+		},
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateSellerOrders(db, &order); err != nil {
+		t.Fatal(err)
+	}
+	return &order, product
+}
+
+// newSplitOrder places a pending order for 2 units from each of two sellers:
+// a 5.00 product and a 7.00 product, both with 10 in stock.
+func newSplitOrder(t *testing.T, db *gorm.DB) (*models.Order, []*models.Product) {
+	t.Helper()
+	buyer := testdb.User(t, db, "buyer@example.com")
+	products := []*models.Product{
+		testdb.Product(t, db, testdb.User(t, db, "a@example.com").ID, "Mug", 5, 10),
+		testdb.Product(t, db, testdb.User(t, db, "b@example.com").ID, "Plate", 7, 10),
+	}
+
+	order := models.Order{UserID: buyer.ID, Status: "pending"}
+	for _, product := range products {
+		order.Total += product.Price * 2
+		order.OrderItems = append(order.OrderItems, models.OrderItem{
+			ProductID: product.ID, Quantity: 2, Price: product.Price, SellerID: product.OwnerID,
+		})
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateSellerOrders(db, &order); err != nil {
+		t.Fatal(err)
+	}
+	return &order, products
+}
+
+func setStatus(t *testing.T, db *gorm.DB, order *models.Order, status string) error {
+	t.Helper()
+	if err := db.First(order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return SetStatus(tx, order, nil, status)
+	})
+}
+
+func stock(t *testing.T, db *gorm.DB, product *models.Product) int {
+	t.Helper()
+	var current models.Product
+	if err := db.First(&current, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return current.Stock
+}
+
+func TestPendingOrderMustBePaidFirst(t *testing.T) {
+	for _, status := range []string{"processing", "shipped", "delivered"} {
+		t.Run(status, func(t *testing.T) {
+			db := newTestDB(t)
+			order, product := newTestOrder(t, db, 2)
+
+			if err := setStatus(t, db, order, status); !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("pending -> %s: got %v, want ErrInvalidTransition", status, err)
+			}
+
+			sellerOrder := order.SellerOrders[0]
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return SetSellerOrderStatus(tx, &sellerOrder, nil, status)
+			})
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("pending sub-order -> %s: got %v, want ErrInvalidTransition", status, err)
+			}
+
+			db.First(order, order.ID)
+			if order.Status != "pending" {
+				t.Errorf("order status = %s, want pending", order.Status)
+			}
+			if got := stock(t, db, product); got != 10 {
+				t.Errorf("stock = %d, want 10", got)
+			}
+		})
+	}
+}
+
+func TestPaidProcessingCancelled(t *testing.T) {
+	db := newTestDB(t)
+	order, product := newTestOrder(t, db, 2)
+
+	if err := setStatus(t, db, order, "paid"); err != nil {
+		t.Fatalf("pending -> paid: %v", err)
+	}
+	if got := stock(t, db, product); got != 8 {
+		t.Fatalf("stock after payment = %d, want 8", got)
+	}
+	if err := setStatus(t, db, order, "paid"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("paid -> paid: got %v, want ErrInvalidTransition", err)
+	}
+
+	if err := setStatus(t, db, order, "processing"); err != nil {
+		t.Fatalf("paid -> processing: %v", err)
+	}
+	if err := setStatus(t, db, order, "cancelled"); err != nil {
+		t.Fatalf("processing -> cancelled: %v", err)
+	}
+	if got := stock(t, db, product); got != 10 {
+		t.Errorf("stock after cancelling = %d, want 10", got)
+	}
+
+	var sellerOrder models.SellerOrder
+	db.Where("order_id = ?", order.ID).First(&sellerOrder)
+	if sellerOrder.Status != "cancelled" {
+		t.Errorf("sub-order status = %s, want cancelled", sellerOrder.Status)
+	}
+	if err := setStatus(t, db, order, "processing"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("cancelled -> processing: got %v, want ErrInvalidTransition", err)
+	}
+}
+
+// TestStockMovementsRecordActor pays for an order as an admin, cancels it as
+// its seller, and expects each stock movement to say who made it and why.
+func TestStockMovementsRecordActor(t *testing.T) {
+	db := newTestDB(t)
+	order, product := newTestOrder(t, db, 2)
+	admin := testdb.User(t, db, "admin@example.com")
+	seller := product.OwnerID
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return SetStatus(tx, order, &admin.ID, "paid")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var sellerOrder models.SellerOrder
+	if err := db.Where("order_id = ?", order.ID).First(&sellerOrder).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return SetSellerOrderStatus(tx, &sellerOrder, &seller, "cancelled")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var movements []models.StockMovement
+	if err := db.Where("order_id = ?", order.ID).Order("id").Find(&movements).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		delta   int
+		reason  string
+		note    string
+		actorID uint
+	}{
+		{-2, "order_placed", fmt.Sprintf("order #%d placed", order.ID), admin.ID},
+		{2, "order_cancelled", fmt.Sprintf("order #%d cancelled", order.ID), seller},
+	}
+	if len(movements) != len(want) {
+		t.Fatalf("got %d movements, want %d", len(movements), len(want))
+	}
+	for i, w := range want {
+		m := movements[i]
+		if m.Delta != w.delta || m.Reason != w.reason || m.Note != w.note || m.ActorID == nil || *m.ActorID != w.actorID {
+			t.Errorf("movement %d = %+v, want delta %d, reason %q, note %q by %d", i, m, w.delta, w.reason, w.note, w.actorID)
+		}
+	}
+}
+
+func TestCancelUnpaidProcessingOrderDoesNotRestock(t *testing.T) {
+	db := newTestDB(t)
+	order, product := newTestOrder(t, db, 2)
+
+	// Orders could reach processing without being paid before the status
+	// rules were enforced.
+	db.Model(&models.Order{}).Where("id = ?", order.ID).Update("status", "processing")
+	db.Model(&models.SellerOrder{}).Where("order_id = ?", order.ID).Update("status", "processing")
+
+	if err := setStatus(t, db, order, "cancelled"); err != nil {
+		t.Fatalf("processing -> cancelled: %v", err)
+	}
+	if got := stock(t, db, product); got != 10 {
+		t.Errorf("stock = %d, want 10", got)
+	}
+
+	var movements int64
+	db.Model(&models.StockMovement{}).Where("order_id = ?", order.ID).Count(&movements)
+	if movements != 0 {
+		t.Errorf("recorded %d stock movements for an order that never took stock", movements)
+	}
+}
+
+func TestDeliveredOrderHasSale(t *testing.T) {
+	// A step moves the order to status and expects err back.
+	type step struct {
+		status string
+		err    error
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		delivered bool
+	}{
+		{"straight to delivered", []step{
+			{"delivered", ErrInvalidTransition},
+		}, false},
+		{"skipping payment", []step{
+			{"processing", ErrInvalidTransition},
+			{"shipped", ErrInvalidTransition},
+			{"delivered", ErrInvalidTransition},
+		}, false},
+		{"paid first", []step{
+			{"paid", nil},
+			{"processing", nil},
+			{"shipped", nil},
+			{"delivered", nil},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			order, _ := newTestOrder(t, db, 1)
+
+			for _, step := range tt.steps {
+				if err := setStatus(t, db, order, step.status); !errors.Is(err, step.err) {
+					t.Fatalf("%s -> %s: got %v, want %v", order.Status, step.status, err, step.err)
+				}
+			}
+
+			if err := db.First(order, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if delivered := order.Status == "delivered"; delivered != tt.delivered {
+				t.Fatalf("order status = %s after %v", order.Status, tt.steps)
+			}
+
+			var delivered, sales int64
+			if err := db.Model(&models.SellerOrder{}).
+				Where("order_id = ? AND status = ?", order.ID, "delivered").
+				Count(&delivered).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Model(&models.LedgerTransaction{}).
+				Where("order_id = ? AND kind = ?", order.ID, ledger.KindSale).
+				Count(&sales).Error; err != nil {
+				t.Fatal(err)
+			}
+			if sales < delivered {
+				t.Errorf("%d sub-orders delivered but %d sales in the ledger", delivered, sales)
+			}
+		})
+	}
+}
+
+func TestCancellingRebuildsSalesRollup(t *testing.T) {
+	db := newTestDB(t)
+	order, _ := newTestOrder(t, db, 2)
+	if err := setStatus(t, db, order, "paid"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paid long enough ago to be outside the regular rebuild.
+	paidAt := time.Now().AddDate(0, 0, -30)
+	if err := db.Model(&models.Order{}).Where("id = ?", order.ID).Update("paid_at", paidAt).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reports.Rollup(db, 31); err != nil {
+		t.Fatal(err)
+	}
+	date := paidAt.Format("2006-01-02")
+
+	var rollup models.DailySalesRollup
+	if err := db.Where("date = ?", date).First(&rollup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Orders != 1 || rollup.Revenue != 10 {
+		t.Fatalf("rollup before cancelling = %d orders, %v revenue; want 1, 10", rollup.Orders, rollup.Revenue)
+	}
+
+	if err := setStatus(t, db, order, "cancelled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("date = ?", date).First(&rollup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Orders != 0 || rollup.Revenue != 0 {
+		t.Errorf("rollup after cancelling = %d orders, %v revenue; want 0, 0", rollup.Orders, rollup.Revenue)
+	}
+}
+
+// TestCancellingSubOrderRebuildsSalesRollup cancels one seller's part of a
+// paid order and expects the rest of the order to stay in the day's sales.
+func TestCancellingSubOrderRebuildsSalesRollup(t *testing.T) {
+	db := newTestDB(t)
+	order, products := newSplitOrder(t, db)
+	if err := setStatus(t, db, order, "paid"); err != nil {
+		t.Fatal(err)
+	}
+
+	paidAt := time.Now().AddDate(0, 0, -30)
+	if err := db.Model(&models.Order{}).Where("id = ?", order.ID).Update("paid_at", paidAt).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reports.Rollup(db, 31); err != nil {
+		t.Fatal(err)
+	}
+	date := paidAt.Format("2006-01-02")
+
+	var rollup models.DailySalesRollup
+	if err := db.Where("date = ?", date).First(&rollup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Orders != 1 || rollup.Items != 4 || rollup.Revenue != 24 {
+		t.Fatalf("rollup before cancelling = %d orders, %d items, %v revenue; want 1, 4, 24", rollup.Orders, rollup.Items, rollup.Revenue)
+	}
+
+	var plates models.SellerOrder
+	if err := db.Where("order_id = ? AND seller_id = ?", order.ID, products[1].OwnerID).First(&plates).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return SetSellerOrderStatus(tx, &plates, nil, "cancelled")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("date = ?", date).First(&rollup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Orders != 1 || rollup.Items != 2 || rollup.Revenue != 10 {
+		t.Errorf("rollup after cancelling = %d orders, %d items, %v revenue; want 1, 2, 10", rollup.Orders, rollup.Items, rollup.Revenue)
+	}
+}
+
+func TestCancelShippedOrder(t *testing.T) {
+	db := newTestDB(t)
+	order, product := newTestOrder(t, db, 2)
+	if err := setStatus(t, db, order, "paid"); err != nil {
+		t.Fatal(err)
+	}
+
+	var sellerOrder models.SellerOrder
+	db.Where("order_id = ?", order.ID).First(&sellerOrder)
+	shipment := models.Shipment{Carrier: "UPS", TrackingNumber: "1Z"}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return CreateShipment(tx, &sellerOrder, &shipment, nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setStatus(t, db, order, "cancelled"); !errors.Is(err, ErrShipped) {
+		t.Errorf("cancelling the order: got %v, want ErrShipped", err)
+	}
+	db.First(&sellerOrder, sellerOrder.ID)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return SetSellerOrderStatus(tx, &sellerOrder, nil, "cancelled")
+	})
+	if !errors.Is(err, ErrShipped) {
+		t.Errorf("cancelling the sub-order: got %v, want ErrShipped", err)
+	}
+	if got := stock(t, db, product); got != 8 {
+		t.Errorf("stock = %d, want 8", got)
+	}
+}
+
+func TestStatusOnlyMovesForward(t *testing.T) {
+	db := newTestDB(t)
+	order, _ := newTestOrder(t, db, 1)
+	if err := setStatus(t, db, order, "paid"); err != nil {
+		t.Fatal(err)
+	}
+
+	var sellerOrder models.SellerOrder
+	db.Where("order_id = ?", order.ID).First(&sellerOrder)
+	for _, step := range []struct {
+		status string
+		err    error
+	}{
+		{"processing", nil},
+		{"processing", ErrInvalidTransition},
+		{"shipped", nil},
+		{"processing", ErrInvalidTransition},
+		{"paid", ErrInvalidTransition},
+		{"delivered", nil},
+		{"cancelled", ErrInvalidTransition},
+	} {
+		from := sellerOrder.Status
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return SetSellerOrderStatus(tx, &sellerOrder, nil, step.status)
+		})
+		if !errors.Is(err, step.err) {
+			t.Fatalf("sub-order %s -> %s: got %v, want %v", from, step.status, err, step.err)
+		}
+		db.First(&sellerOrder, sellerOrder.ID)
+	}
+
+	db.First(order, order.ID)
+	if order.Status != "delivered" {
+		t.Errorf("order status = %s, want delivered", order.Status)
+	}
+	if err := setStatus(t, db, order, "processing"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("delivered -> processing: got %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestPayOrderWithCancelledSubOrder(t *testing.T) {
+	db := newTestDB(t)
+	order, products := newSplitOrder(t, db)
+
+	var cancelled models.SellerOrder
+	if err := db.Where("order_id = ? AND seller_id = ?", order.ID, products[1].OwnerID).First(&cancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return SetSellerOrderStatus(tx, &cancelled, nil, "cancelled")
+	}); err != nil {
+		t.Fatalf("cancelling the pending sub-order: %v", err)
+	}
+	if err := setStatus(t, db, order, "paid"); err != nil {
+		t.Fatalf("pending -> paid: %v", err)
+	}
+
+	if got := stock(t, db, products[0]); got != 8 {
+		t.Errorf("stock of the paid item = %d, want 8", got)
+	}
+	if got := stock(t, db, products[1]); got != 10 {
+		t.Errorf("stock of the cancelled item = %d, want 10", got)
+	}
+
+	if err := db.First(order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Total != 10 {
+		t.Errorf("total = %v, want 10", order.Total)
+	}
+	if order.InvoiceNumber == nil {
+		t.Fatal("paid order has no invoice number")
+	}
+
+	var sales int64
+	if err := db.Model(&models.LedgerTransaction{}).
+		Where("order_id = ? AND kind = ?", order.ID, ledger.KindSale).
+		Count(&sales).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sales != 1 {
+		t.Errorf("%d sales in the ledger, want 1", sales)
+	}
+
+	invoice, err := documents.Invoice(db, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(invoice, []byte("(Mug) Tj")) {
+		t.Error("invoice does not list the paid item")
+	}
+	if bytes.Contains(invoice, []byte("(Plate) Tj")) {
+		t.Error("invoice lists the item of the cancelled sub-order")
+	}
+}
@@ -0,0 +1,190 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Shipment statuses, in the order a parcel goes through them.
+const (
+	ShipmentShipped   = "shipped"
+	ShipmentInTransit = "in_transit"
+	ShipmentDelivered = "delivered"
+)
+
+var shipmentSteps = map[string]int{
+	ShipmentShipped:   0,
+	ShipmentInTransit: 1,
+	ShipmentDelivered: 2,
+}
+
+var (
+	ErrNotShippable  = errors.New("order cannot be shipped")
+	ErrNothingToShip = errors.New("nothing left to ship")
+	ErrShipped       = errors.New("order has items that have shipped")
+)
+
+// ShipmentError reports a requested shipment line that does not fit the
+// order.
+type ShipmentError struct {
+	OrderItemID uint
+	Message     string
+}
+
+func (e *ShipmentError) Error() string {
+	return fmt.Sprintf("order item %d: %s", e.OrderItemID, e.Message)
+}
+
+// Shipped sums how many units of each of a sub-order's items have been
+// shipped so far.
+func Shipped(tx *gorm.DB, sellerOrderID uint) (map[uint]int, error) {
+	var rows []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	if err := tx.Model(&models.ShipmentItem{}).
+		Select("shipment_items.order_item_id, SUM(shipment_items.quantity) AS quantity").
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id AND shipments.deleted_at IS NULL").
+		Where("shipments.seller_order_id = ?", sellerOrderID).
+		Group("shipment_items.order_item_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	shipped := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		shipped[row.OrderItemID] = row.Quantity
+	}
+	return shipped, nil
+}
+
+// CreateShipment records a shipment for a paid sub-order. lines maps order
+// items to the quantity shipped; when it is empty, everything not shipped
+// yet goes out. The sub-order moves to processing, or to shipped once all of
+// its items have gone out.
+func CreateShipment(tx *gorm.DB, sellerOrder *models.SellerOrder, shipment *models.Shipment, lines map[uint]int) error {
+	if sellerOrder.Status != "paid" && sellerOrder.Status != "processing" {
+		return ErrNotShippable
+	}
+
+	var items []models.OrderItem
+	if err := tx.Where("seller_order_id = ?", sellerOrder.ID).Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+	shipped, err := Shipped(tx, sellerOrder.ID)
+	if err != nil {
+		return err
+	}
+
+	remaining := make(map[uint]int, len(items))
+	for _, item := range items {
+		remaining[item.ID] = item.Quantity - shipped[item.ID]
+	}
+
+	shipment.Items = nil
+	if len(lines) == 0 {
+		for _, item := range items {
+			if remaining[item.ID] > 0 {
+				shipment.Items = append(shipment.Items, models.ShipmentItem{
+					OrderItemID: item.ID,
+					Quantity:    remaining[item.ID],
+				})
+			}
+		}
+	} else {
+		for id := range lines {
+			if _, ok := remaining[id]; !ok {
+				return &ShipmentError{OrderItemID: id, Message: "not part of this order"}
+			}
+		}
+		for _, item := range items {
+			quantity, ok := lines[item.ID]
+			if !ok {
+				continue
+			}
+			if quantity > remaining[item.ID] {
+				return &ShipmentError{
+					OrderItemID: item.ID,
+					Message:     fmt.Sprintf("only %d left to ship", remaining[item.ID]),
+				}
+			}
+			shipment.Items = append(shipment.Items, models.ShipmentItem{OrderItemID: item.ID, Quantity: quantity})
+		}
+	}
+	if len(shipment.Items) == 0 {
+		return ErrNothingToShip
+	}
+
+	shipment.OrderID = sellerOrder.OrderID
+	shipment.SellerOrderID = sellerOrder.ID
+	shipment.Status = ShipmentShipped
+	shipment.ShippedAt = time.Now()
+	if err := tx.Create(shipment).Error; err != nil {
+		return err
+	}
+
+	complete := true
+	for _, line := range shipment.Items {
+		remaining[line.OrderItemID] -= line.Quantity
+	}
+	for _, left := range remaining {
+		if left > 0 {
+			complete = false
+		}
+	}
+
+	switch {
+	case complete:
+		return SetSellerOrderStatus(tx, sellerOrder, nil, "shipped")
+	case sellerOrder.Status == "paid":
+		return SetSellerOrderStatus(tx, sellerOrder, nil, "processing")
+	}
+	return nil
+}
+
+// SetShipmentStatus moves a shipment forward to in_transit or delivered.
+// Once every item of the sub-order has shipped and every shipment has been
+// delivered, the sub-order is delivered too.
+func SetShipmentStatus(tx *gorm.DB, shipment *models.Shipment, status string) error {
+	if shipmentSteps[status] <= shipmentSteps[shipment.Status] {
+		return ErrInvalidTransition
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": status}
+	switch status {
+	case ShipmentInTransit:
+		updates["in_transit_at"] = now
+	case ShipmentDelivered:
+		updates["delivered_at"] = now
+	}
+	if err := tx.Model(shipment).Updates(updates).Error; err != nil {
+		return err
+	}
+	if status != ShipmentDelivered {
+		return nil
+	}
+
+	var sellerOrder models.SellerOrder
+	if err := tx.First(&sellerOrder, shipment.SellerOrderID).Error; err != nil {
+		return err
+	}
+	if sellerOrder.Status != "shipped" {
+		return nil
+	}
+	var undelivered int64
+	if err := tx.Model(&models.Shipment{}).
+		Where("seller_order_id = ? AND status <> ?", sellerOrder.ID, ShipmentDelivered).
+		Count(&undelivered).Error; err != nil {
+		return err
+	}
+	if undelivered > 0 {
+		return nil
+	}
+	return SetSellerOrderStatus(tx, &sellerOrder, nil, "delivered")
+}
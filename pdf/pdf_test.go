@@ -0,0 +1,146 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain text 123", "plain text 123"},
+		{"(a) b", `\(a\) b`},
+		{`back\slash`, `back\\slash`},
+		{"line\nbreak\ttab", "line break tab"},
+		{"café", `caf\351`},
+		{"£5", `\2435`},
+		{"€ and ✓", "? and ?"},
+		{"bell\a", "bell?"},
+	}
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+var (
+	startxrefRe = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	sizeRe      = regexp.MustCompile(`/Size (\d+)`)
+	countRe     = regexp.MustCompile(`/Count (\d+)`)
+	streamRe    = regexp.MustCompile(`<< /Length (\d+) >>\nstream\n`)
+)
+
+// checkStructure verifies the parts of a PDF a reader relies on to find its
+// objects: the header, the xref table offsets, the trailer and the stream
+// lengths.
+func checkStructure(t *testing.T, data []byte, pages int) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Fatalf("missing header: %q", data[:min(len(data), 16)])
+	}
+
+	m := startxrefRe.FindSubmatch(data)
+	if m == nil {
+		t.Fatal("missing startxref and end-of-file marker")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if xref >= len(data) || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	lines := strings.Split(string(data[xref:]), "\n")
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 {
+		t.Fatalf("bad xref subsection header %q", lines[1])
+	}
+	if lines[2] != "0000000000 65535 f " {
+		t.Errorf("bad free entry %q", lines[2])
+	}
+	for n := 1; n < count; n++ {
+		entry := lines[2+n]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("bad xref entry %d: %q", n, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		header := strconv.Itoa(n) + " 0 obj\n"
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Errorf("xref entry %d points at %q, want %q", n, data[offset:offset+len(header)], header)
+		}
+	}
+
+	if m := sizeRe.FindSubmatch(data[xref:]); m == nil || string(m[1]) != strconv.Itoa(count) {
+		t.Errorf("trailer /Size does not match the %d xref entries", count)
+	}
+	if want := 5 + 2*pages + 1; count != want {
+		t.Errorf("xref has %d entries, want %d", count, want)
+	}
+	if m := countRe.FindSubmatch(data); m == nil || string(m[1]) != strconv.Itoa(pages) {
+		t.Errorf("page tree /Count does not match %d pages", pages)
+	}
+
+	streams := streamRe.FindAllSubmatchIndex(data, -1)
+	if len(streams) != pages {
+		t.Fatalf("found %d content streams, want %d", len(streams), pages)
+	}
+	for _, s := range streams {
+		length, _ := strconv.Atoi(string(data[s[2]:s[3]]))
+		start := s[1]
+		if !bytes.HasPrefix(data[start+length:], []byte("endstream\n")) {
+			t.Errorf("stream at %d: /Length %d does not end at endstream", start, length)
+		}
+	}
+}
+
+func TestWriteToStructure(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		pages    [][]string
+		contains []string
+	}{
+		{"empty document", "Empty", nil, nil},
+		{"one page", "Invoice INV-000001", [][]string{{"Hello", "Total: $12.50"}},
+			[]string{"/Title (Invoice INV-000001)", "(Total: $12.50) Tj"}},
+		{"escaped text", "Café (draft)", [][]string{
+			{`a (nested) \ string`, "price £5", "emoji ✓", "line\nbreak"},
+		}, []string{`/Title (Caf\351 \(draft\))`, `(a \(nested\) \\ string) Tj`, `(price \2435) Tj`, "(emoji ?) Tj", "(line break) Tj"}},
+		{"several pages", "Packing slip", [][]string{
+			{"Page one"}, {}, {"Page three", "with (parens)"},
+		}, []string{`(with \(parens\)) Tj`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := New(tt.title)
+			for _, texts := range tt.pages {
+				page := doc.AddPage()
+				for i, text := range texts {
+					page.Text(50, PageHeight-50-float64(i)*20, 10, i == 0, text)
+				}
+				page.Line(50, 50, PageWidth-50, 50, 0.5)
+			}
+			pages := max(len(tt.pages), 1)
+
+			var buf bytes.Buffer
+			n, err := doc.WriteTo(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buf.Len()) {
+				t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+			}
+			checkStructure(t, buf.Bytes(), pages)
+			for _, want := range tt.contains {
+				if !bytes.Contains(buf.Bytes(), []byte(want)) {
+					t.Errorf("document does not contain %q", want)
+				}
+			}
+		})
+	}
+}
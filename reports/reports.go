@@ -0,0 +1,127 @@
+package reports
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// StatusCount is how many orders placed in a range are in one status.
+type StatusCount struct {
+	Status string  `json:"status"`
+	Orders int64   `json:"orders"`
+	Total  float64 `json:"total"`
+}
+
+// OrdersByStatus counts the orders placed in [from, to) by their current
+// status.
+func OrdersByStatus(db *gorm.DB, from, to time.Time) ([]StatusCount, error) {
+	counts := []StatusCount{}
+	err := db.Model(&models.Order{}).
+		Select("status, COUNT(*) AS orders, COALESCE(SUM(total), 0) AS total").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("status").
+		Order("orders DESC, status").
+		Scan(&counts).Error
+	for i := range counts {
+		counts[i].Total = round(counts[i].Total)
+	}
+	return counts, err
+}
+
+// ProductSales is how much of one product sold in a range.
+type ProductSales struct {
+	ProductID uint    `json:"product_id"`
+	Name      string  `json:"name"`
+	SKU       string  `json:"sku"`
+	Quantity  int     `json:"quantity"`
+	Orders    int     `json:"orders"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// TopProducts ranks the products sold in orders paid in [from, to) by
+// quantity or by revenue, leaving out items of cancelled sub-orders. Deleted
+// products are still listed.
+func TopProducts(db *gorm.DB, from, to time.Time, by string, limit int) ([]ProductSales, error) {
+	order := "quantity DESC"
+	if by == "revenue" {
+		order = "revenue DESC"
+	}
+
+	products := []ProductSales{}
+	err := db.Model(&models.OrderItem{}).
+		Select("order_items.product_id, products.name, products.sku, "+
+			"SUM(order_items.quantity) AS quantity, COUNT(DISTINCT order_items.order_id) AS orders, "+
+			"SUM(order_items.quantity * order_items.price) AS revenue").
+		Joins("JOIN seller_orders ON seller_orders.id = order_items.seller_order_id").
+		Joins("JOIN orders ON orders.id = seller_orders.order_id").
+		Joins("LEFT JOIN products ON products.id = order_items.product_id").
+		Where("seller_orders.status IN ?", PaidStatuses).
+		Where("orders.paid_at >= ? AND orders.paid_at < ?", from, to).
+		Group("order_items.product_id, products.name, products.sku").
+		Order(order + ", order_items.product_id").
+		Limit(limit).
+		Scan(&products).Error
+	for i := range products {
+		products[i].Revenue = round(products[i].Revenue)
+	}
+	return products, err
+}
+
+// Customers splits the customers who paid for an order in a range into new
+// ones, whose first paid order falls in the range, and returning ones.
+type Customers struct {
+	Customers     int64   `json:"customers"`
+	New           int64   `json:"new"`
+	Returning     int64   `json:"returning"`
+	ReturningRate float64 `json:"returning_rate"`
+}
+
+// NewAndReturning counts new and returning customers for orders paid in
+// [from, to).
+func NewAndReturning(db *gorm.DB, from, to time.Time) (Customers, error) {
+	firstPaid := db.Model(&models.Order{}).
+		Select("user_id, MIN(paid_at) AS first_paid_at").
+		Where("status IN ? AND paid_at IS NOT NULL", PaidStatuses).
+		Group("user_id")
+
+	var customers Customers
+	err := db.Table("(?) AS first_orders", firstPaid).
+		Select("COUNT(*) AS customers, COALESCE(SUM(CASE WHEN first_paid_at >= ? THEN 1 ELSE 0 END), 0) AS new", from).
+		Where("user_id IN (?)", paidOrders(db, from, to).Select("orders.user_id")).
+		Scan(&customers).Error
+	customers.Returning = customers.Customers - customers.New
+	if customers.Customers > 0 {
+		customers.ReturningRate = round(float64(customers.Returning) / float64(customers.Customers))
+	}
+	return customers, err
+}
+
+// SellerSales is one seller's share of the orders paid in a range.
+type SellerSales struct {
+	SellerID  uint    `json:"seller_id"`
+	StoreName string  `json:"store_name"`
+	Email     string  `json:"email"`
+	Orders    int     `json:"orders"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// SellerRevenue sums each seller's sub-orders of orders paid in [from, to),
+// leaving out sub-orders that were cancelled.
+func SellerRevenue(db *gorm.DB, from, to time.Time) ([]SellerSales, error) {
+	sellers := []SellerSales{}
+	err := soldSellerOrders(db, from, to).
+		Select("seller_orders.seller_id, seller_profiles.store_name, users.email, " +
+			"COUNT(*) AS orders, SUM(seller_orders.subtotal) AS revenue").
+		Joins("LEFT JOIN seller_profiles ON seller_profiles.user_id = seller_orders.seller_id AND seller_profiles.deleted_at IS NULL").
+		Joins("LEFT JOIN users ON users.id = seller_orders.seller_id").
+		Group("seller_orders.seller_id, seller_profiles.store_name, users.email").
+		Order("revenue DESC, seller_orders.seller_id").
+		Scan(&sellers).Error
+	for i := range sellers {
+		sellers[i].Revenue = round(sellers[i].Revenue)
+	}
+	return sellers, err
+}
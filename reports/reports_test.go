@@ -0,0 +1,235 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/testdb"
+)
+
+// item is a quantity of one product in a sub-order.
+type item struct {
+	product  *models.Product
+	quantity int
+}
+
+// subOrder is one seller's part of an order; the seller is the owner of its
+// first product.
+type subOrder struct {
+	status string
+	items  []item
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	return testdb.Open(t, &models.User{}, &models.Product{}, &models.Order{}, &models.OrderItem{},
+		&models.SellerOrder{}, &models.SellerProfile{}, &models.DailySalesRollup{})
+}
+
+// day returns noon of the day n days from today.
+func day(n int) time.Time {
+	return Midnight(time.Now()).AddDate(0, 0, n).Add(12 * time.Hour)
+}
+
+// placeOrder creates an order of buyer paid at paidAt, or left pending when
+// paidAt is zero. The order is cancelled when all of its sub-orders are.
+func placeOrder(t *testing.T, db *gorm.DB, buyer *models.User, paidAt time.Time, subOrders ...subOrder) *models.Order {
+	t.Helper()
+	order := models.Order{UserID: buyer.ID, Status: "cancelled"}
+	if paidAt.IsZero() {
+		order.Status = "pending"
+	} else {
+		order.PaidAt = &paidAt
+	}
+	for _, sub := range subOrders {
+		if sub.status != "cancelled" && order.Status == "cancelled" {
+			order.Status = "paid"
+		}
+		for _, it := range sub.items {
+			order.Total += float64(it.quantity) * it.product.Price
+		}
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range subOrders {
+		sellerOrder := models.SellerOrder{OrderID: order.ID, SellerID: sub.items[0].product.OwnerID, Status: sub.status}
+		for _, it := range sub.items {
+			sellerOrder.Subtotal += float64(it.quantity) * it.product.Price
+		}
+		if err := db.Create(&sellerOrder).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range sub.items {
+			orderItem := models.OrderItem{
+				OrderID:       order.ID,
+				ProductID:     it.product.ID,
+				Quantity:      it.quantity,
+				Price:         it.product.Price,
+				SellerID:      sellerOrder.SellerID,
+				SellerOrderID: &sellerOrder.ID,
+			}
+			if err := db.Create(&orderItem).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return &order
+}
+
+// salesFixture has two sellers: a, with a store profile, sells mugs and
+// bowls, and b sells plates. Bowls have since been deleted.
+func salesFixture(t *testing.T) (db *gorm.DB, mug, plate, bowl *models.Product) {
+	db = newTestDB(t)
+	a := testdb.User(t, db, "a@example.com")
+	b := testdb.User(t, db, "b@example.com")
+	if err := db.Create(&models.SellerProfile{UserID: a.ID, StoreName: "A Store"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	mug = testdb.Product(t, db, a.ID, "Mug", 5, 100)
+	plate = testdb.Product(t, db, b.ID, "Plate", 7, 100)
+	bowl = testdb.Product(t, db, a.ID, "Bowl", 20, 100)
+
+	alice := testdb.User(t, db, "alice@example.com")
+	bob := testdb.User(t, db, "bob@example.com")
+	placeOrder(t, db, alice, day(-2),
+		subOrder{"delivered", []item{{mug, 3}, {bowl, 1}}},
+		subOrder{"shipped", []item{{plate, 1}}})
+	placeOrder(t, db, bob, day(-1),
+		subOrder{"cancelled", []item{{mug, 5}}},
+		subOrder{"paid", []item{{plate, 2}}})
+	placeOrder(t, db, bob, day(-20),
+		subOrder{"delivered", []item{{mug, 10}}})
+	placeOrder(t, db, alice, time.Time{},
+		subOrder{"pending", []item{{plate, 9}}})
+
+	if err := db.Delete(bowl).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, mug, plate, bowl
+}
+
+func TestTopProducts(t *testing.T) {
+	db, mug, plate, bowl := salesFixture(t)
+	from, to := Midnight(day(-9)), Midnight(day(1))
+
+	tests := []struct {
+		name  string
+		by    string
+		limit int
+		want  []ProductSales
+	}{
+		{"by quantity", "quantity", 10, []ProductSales{
+			{ProductID: mug.ID, Name: "Mug", Quantity: 3, Orders: 1, Revenue: 15},
+			{ProductID: plate.ID, Name: "Plate", Quantity: 3, Orders: 2, Revenue: 21},
+			{ProductID: bowl.ID, Name: "Bowl", Quantity: 1, Orders: 1, Revenue: 20},
+		}},
+		{"by revenue", "revenue", 10, []ProductSales{
+			{ProductID: plate.ID, Name: "Plate", Quantity: 3, Orders: 2, Revenue: 21},
+			{ProductID: bowl.ID, Name: "Bowl", Quantity: 1, Orders: 1, Revenue: 20},
+			{ProductID: mug.ID, Name: "Mug", Quantity: 3, Orders: 1, Revenue: 15},
+		}},
+		{"limited", "revenue", 1, []ProductSales{
+			{ProductID: plate.ID, Name: "Plate", Quantity: 3, Orders: 2, Revenue: 21},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TopProducts(db, from, to, tt.by, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("product %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSellerRevenue(t *testing.T) {
+	db, mug, plate, _ := salesFixture(t)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []SellerSales
+	}{
+		{"cancelled sub-orders left out", Midnight(day(-9)), Midnight(day(1)), []SellerSales{
+			{SellerID: mug.OwnerID, StoreName: "A Store", Email: "a@example.com", Orders: 1, Revenue: 35},
+			{SellerID: plate.OwnerID, Email: "b@example.com", Orders: 2, Revenue: 21},
+		}},
+		{"older sales", Midnight(day(-30)), Midnight(day(-9)), []SellerSales{
+			{SellerID: mug.OwnerID, StoreName: "A Store", Email: "a@example.com", Orders: 1, Revenue: 50},
+		}},
+		{"nothing sold", Midnight(day(-60)), Midnight(day(-30)), []SellerSales{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SellerRevenue(db, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("seller %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewAndReturning(t *testing.T) {
+	db := newTestDB(t)
+	mug := testdb.Product(t, db, testdb.User(t, db, "seller@example.com").ID, "Mug", 5, 100)
+	paid := subOrder{"paid", []item{{mug, 1}}}
+	cancelled := subOrder{"cancelled", []item{{mug, 1}}}
+
+	alice := testdb.User(t, db, "alice@example.com")
+	placeOrder(t, db, alice, day(-40), paid)
+	placeOrder(t, db, alice, day(-5), paid)
+	bob := testdb.User(t, db, "bob@example.com")
+	placeOrder(t, db, bob, day(-3), paid)
+	placeOrder(t, db, bob, day(-2), paid)
+	// Carol's first order was cancelled, so she is new when she next pays.
+	carol := testdb.User(t, db, "carol@example.com")
+	placeOrder(t, db, carol, day(-60), cancelled)
+	placeOrder(t, db, carol, day(-2), paid)
+	// Dave never paid.
+	placeOrder(t, db, testdb.User(t, db, "dave@example.com"), time.Time{}, subOrder{"pending", []item{{mug, 1}}})
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     Customers
+	}{
+		{"last ten days", Midnight(day(-9)), Midnight(day(1)), Customers{Customers: 3, New: 2, Returning: 1, ReturningRate: 0.33}},
+		{"only returning", Midnight(day(-5)), Midnight(day(-4)), Customers{Customers: 1, Returning: 1, ReturningRate: 1}},
+		{"first orders", Midnight(day(-45)), Midnight(day(-35)), Customers{Customers: 1, New: 1}},
+		{"only cancelled", Midnight(day(-61)), Midnight(day(-59)), Customers{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAndReturning(db, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
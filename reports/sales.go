@@ -0,0 +1,251 @@
+// Package reports computes sales figures for admins. Revenue counts the
+// sub-orders that were paid and have not been cancelled, on the day their
+// order was paid.
+package reports
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// PaidStatuses are the statuses of orders and sub-orders that count as sales.
+var PaidStatuses = []string{"paid", "processing", "shipped", "delivered"}
+
+const dateLayout = "2006-01-02"
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Midnight returns the start of t's local calendar day.
+func Midnight(t time.Time) time.Time {
+	year, month, day := t.In(time.Local).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+// paidOrders selects orders paid in [from, to) that still count as sales.
+func paidOrders(db *gorm.DB, from, to time.Time) *gorm.DB {
+	return db.Model(&models.Order{}).
+		Where("orders.status IN ? AND orders.paid_at >= ? AND orders.paid_at < ?", PaidStatuses, from, to)
+}
+
+// soldSellerOrders selects the sub-orders of orders paid in [from, to) that
+// still count as sales. Sub-orders cancelled after payment are left out even
+// when the rest of their order went ahead.
+func soldSellerOrders(db *gorm.DB, from, to time.Time) *gorm.DB {
+	return db.Model(&models.SellerOrder{}).
+		Joins("JOIN orders ON orders.id = seller_orders.order_id AND orders.deleted_at IS NULL").
+		Where("seller_orders.status IN ?", PaidStatuses).
+		Where("orders.paid_at >= ? AND orders.paid_at < ?", from, to)
+}
+
+// Day is the sales of one calendar day.
+type Day struct {
+	Date    string  `json:"date"`
+	Orders  int     `json:"orders"`
+	Items   int     `json:"items"`
+	Revenue float64 `json:"revenue"`
+}
+
+// liveDays adds up sales per day straight from the sub-orders of orders paid
+// in [from, to). Sub-orders are read one row at a time.
+func liveDays(db *gorm.DB, from, to time.Time) (map[string]*Day, error) {
+	rows, err := soldSellerOrders(db, from, to).
+		Select("seller_orders.order_id, orders.paid_at, seller_orders.subtotal, " +
+			"(SELECT COALESCE(SUM(quantity), 0) FROM order_items WHERE order_items.seller_order_id = seller_orders.id AND order_items.deleted_at IS NULL) AS items").
+		Order("seller_orders.order_id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]*Day)
+	var lastOrderID uint
+	for rows.Next() {
+		var row struct {
+			OrderID  uint
+			PaidAt   time.Time
+			Subtotal float64
+			Items    int
+		}
+		if err := db.ScanRows(rows, &row); err != nil {
+			return nil, err
+		}
+
+		date := row.PaidAt.In(time.Local).Format(dateLayout)
+		day, ok := days[date]
+		if !ok {
+			day = &Day{Date: date}
+			days[date] = day
+		}
+		// Rows come sorted by order, so an order is counted once however
+		// many sellers it was split between.
+		if row.OrderID != lastOrderID {
+			day.Orders++
+			lastOrderID = row.OrderID
+		}
+		day.Items += row.Items
+		day.Revenue += row.Subtotal
+	}
+	return days, rows.Err()
+}
+
+// Daily returns the sales of every day from from to to, both included. Past
+// days are read from the daily rollups where they exist; today and any day
+// not rolled up yet are computed from the sub-orders.
+func Daily(db *gorm.DB, from, to time.Time) ([]Day, error) {
+	from, to = Midnight(from), Midnight(to)
+	today := Midnight(time.Now())
+
+	var rollups []models.DailySalesRollup
+	if err := db.Where("date >= ? AND date <= ?", from.Format(dateLayout), to.Format(dateLayout)).
+		Find(&rollups).Error; err != nil {
+		return nil, err
+	}
+	rolledUp := make(map[string]models.DailySalesRollup, len(rollups))
+	for _, rollup := range rollups {
+		rolledUp[rollup.Date] = rollup
+	}
+
+	var first, last time.Time
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if _, ok := rolledUp[d.Format(dateLayout)]; ok && d.Before(today) {
+			continue
+		}
+		if first.IsZero() {
+			first = d
+		}
+		last = d
+	}
+
+	live := map[string]*Day{}
+	if !first.IsZero() {
+		var err error
+		if live, err = liveDays(db, first, last.AddDate(0, 0, 1)); err != nil {
+			return nil, err
+		}
+	}
+
+	var days []Day
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format(dateLayout)
+		day := Day{Date: date}
+		if rollup, ok := rolledUp[date]; ok && d.Before(today) {
+			day.Orders, day.Items, day.Revenue = rollup.Orders, rollup.Items, rollup.Revenue
+		} else if sales, ok := live[date]; ok {
+			day = *sales
+		}
+		day.Revenue = round(day.Revenue)
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// Rollup rebuilds the daily rollups of the last days complete days. Days are
+// rebuilt rather than only added so that orders and sub-orders cancelled
+// after the fact drop out of the figures.
+func Rollup(db *gorm.DB, days int) (int, error) {
+	if days < 1 {
+		return 0, nil
+	}
+	to := Midnight(time.Now())
+	return rollup(db, to.AddDate(0, 0, -days), to)
+}
+
+// RollupDay rebuilds the rollup of the day t falls on, unless that is today.
+// It is called when a paid order or sub-order is cancelled, so days older
+// than the regular rebuild stay correct.
+func RollupDay(db *gorm.DB, t time.Time) error {
+	from := Midnight(t)
+	if !from.Before(Midnight(time.Now())) {
+		return nil
+	}
+	_, err := rollup(db, from, from.AddDate(0, 0, 1))
+	return err
+}
+
+// rollup rebuilds the rollups of the days in [from, to).
+func rollup(db *gorm.DB, from, to time.Time) (int, error) {
+	live, err := liveDays(db, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format(dateLayout)
+		rollup := models.DailySalesRollup{Date: date}
+		if sales, ok := live[date]; ok {
+			rollup.Orders, rollup.Items, rollup.Revenue = sales.Orders, sales.Items, round(sales.Revenue)
+		}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"orders", "items", "revenue", "updated_at"}),
+		}).Create(&rollup).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Bucket is the sales of a day, week or month. Period is the date the
+// bucket starts on; weeks start on Monday.
+type Bucket struct {
+	Period            string  `json:"period,omitempty"`
+	Orders            int     `json:"orders"`
+	Items             int     `json:"items"`
+	Revenue           float64 `json:"revenue"`
+	AverageOrderValue float64 `json:"average_order_value"`
+}
+
+func (b *Bucket) add(day Day) {
+	b.Orders += day.Orders
+	b.Items += day.Items
+	b.Revenue += day.Revenue
+}
+
+func (b *Bucket) finish() {
+	b.Revenue = round(b.Revenue)
+	if b.Orders > 0 {
+		b.AverageOrderValue = round(b.Revenue / float64(b.Orders))
+	}
+}
+
+func periodStart(date time.Time, group string) time.Time {
+	switch group {
+	case "week":
+		offset := (int(date.Weekday()) + 6) % 7
+		return date.AddDate(0, 0, -offset)
+	case "month":
+		return date.AddDate(0, 0, 1-date.Day())
+	}
+	return date
+}
+
+// Group adds daily sales up by day, week or month, and returns the buckets
+// along with the totals of the whole range.
+func Group(days []Day, group string) ([]Bucket, Bucket) {
+	var buckets []Bucket
+	var total Bucket
+	for _, day := range days {
+		date, _ := time.ParseInLocation(dateLayout, day.Date, time.Local)
+		period := periodStart(date, group).Format(dateLayout)
+		if len(buckets) == 0 || buckets[len(buckets)-1].Period != period {
+			buckets = append(buckets, Bucket{Period: period})
+		}
+		buckets[len(buckets)-1].add(day)
+		total.add(day)
+	}
+	for i := range buckets {
+		buckets[i].finish()
+	}
+	total.finish()
+	return buckets, total
+}
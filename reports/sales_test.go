@@ -0,0 +1,142 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+	"github.com/hannanmiah/golang-tutorial/testdb"
+)
+
+// TestDaily reads rolled up days from their rollups and every other day,
+// including today, from the sub-orders.
+func TestDaily(t *testing.T) {
+	db := newTestDB(t)
+	a := testdb.User(t, db, "a@example.com")
+	b := testdb.User(t, db, "b@example.com")
+	mug := testdb.Product(t, db, a.ID, "Mug", 5, 100)
+	plate := testdb.Product(t, db, b.ID, "Plate", 7, 100)
+	buyer := testdb.User(t, db, "buyer@example.com")
+
+	placeOrder(t, db, buyer, day(-4), subOrder{"delivered", []item{{mug, 2}}})
+	if err := RollupDay(db, day(-4)); err != nil {
+		t.Fatal(err)
+	}
+	// Sold after the rollup was built, so it only shows once it is rebuilt.
+	placeOrder(t, db, buyer, day(-4), subOrder{"paid", []item{{plate, 1}}})
+
+	placeOrder(t, db, buyer, day(-2),
+		subOrder{"paid", []item{{mug, 1}}},
+		subOrder{"cancelled", []item{{plate, 3}}})
+	placeOrder(t, db, buyer, day(-2), subOrder{"cancelled", []item{{mug, 4}}})
+	placeOrder(t, db, buyer, day(0),
+		subOrder{"processing", []item{{mug, 1}}},
+		subOrder{"paid", []item{{plate, 1}}})
+	// A stale rollup of today is ignored.
+	today := models.DailySalesRollup{Date: day(0).Format(dateLayout), Orders: 9, Items: 9, Revenue: 99}
+	if err := db.Create(&today).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(n int) string { return day(n).Format(dateLayout) }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []Day
+	}{
+		{"rolled up and live days", day(-5), day(0), []Day{
+			{Date: date(-5)},
+			{Date: date(-4), Orders: 1, Items: 2, Revenue: 10},
+			{Date: date(-3)},
+			{Date: date(-2), Orders: 1, Items: 1, Revenue: 5},
+			{Date: date(-1)},
+			{Date: date(0), Orders: 1, Items: 2, Revenue: 12},
+		}},
+		{"only live days", day(-2), day(-1), []Day{
+			{Date: date(-2), Orders: 1, Items: 1, Revenue: 5},
+			{Date: date(-1)},
+		}},
+		{"one rolled up day", day(-4), day(-4), []Day{
+			{Date: date(-4), Orders: 1, Items: 2, Revenue: 10},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Daily(db, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("day %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Rebuilding picks up the sale made after the first rollup.
+	if err := RollupDay(db, day(-4)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Daily(db, day(-4), day(-4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Day{Date: date(-4), Orders: 2, Items: 3, Revenue: 17}); len(got) != 1 || got[0] != want {
+		t.Errorf("after rebuilding got %+v, want %+v", got, []Day{want})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	// 2024-01-29 and 2024-02-05 are Mondays.
+	days := []Day{
+		{Date: "2024-01-30", Orders: 2, Items: 3, Revenue: 30},
+		{Date: "2024-01-31", Orders: 1, Items: 1, Revenue: 10},
+		{Date: "2024-02-01"},
+		{Date: "2024-02-04", Orders: 1, Items: 4, Revenue: 20},
+		{Date: "2024-02-05", Orders: 3, Items: 3, Revenue: 10},
+	}
+	total := Bucket{Orders: 7, Items: 11, Revenue: 70, AverageOrderValue: 10}
+
+	tests := []struct {
+		group string
+		want  []Bucket
+	}{
+		{"day", []Bucket{
+			{Period: "2024-01-30", Orders: 2, Items: 3, Revenue: 30, AverageOrderValue: 15},
+			{Period: "2024-01-31", Orders: 1, Items: 1, Revenue: 10, AverageOrderValue: 10},
+			{Period: "2024-02-01"},
+			{Period: "2024-02-04", Orders: 1, Items: 4, Revenue: 20, AverageOrderValue: 20},
+			{Period: "2024-02-05", Orders: 3, Items: 3, Revenue: 10, AverageOrderValue: 3.33},
+		}},
+		{"week", []Bucket{
+			{Period: "2024-01-29", Orders: 4, Items: 8, Revenue: 60, AverageOrderValue: 15},
+			{Period: "2024-02-05", Orders: 3, Items: 3, Revenue: 10, AverageOrderValue: 3.33},
+		}},
+		{"month", []Bucket{
+			{Period: "2024-01-01", Orders: 3, Items: 4, Revenue: 40, AverageOrderValue: 13.33},
+			{Period: "2024-02-01", Orders: 4, Items: 7, Revenue: 30, AverageOrderValue: 7.5},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			buckets, gotTotal := Group(days, tt.group)
+			if len(buckets) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", buckets, tt.want)
+			}
+			for i := range buckets {
+				if buckets[i] != tt.want[i] {
+					t.Errorf("bucket %d = %+v, want %+v", i, buckets[i], tt.want[i])
+				}
+			}
+			if gotTotal != total {
+				t.Errorf("total = %+v, want %+v", gotTotal, total)
+			}
+		})
+	}
+}
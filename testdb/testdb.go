@@ -0,0 +1,49 @@
+// Package testdb sets up throwaway databases for tests.
+package testdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/hannanmiah/golang-tutorial/models"
+)
+
+// Open returns an empty SQLite database in the test's temporary directory
+// with only the given models migrated.
+func Open(t testing.TB, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// User creates a customer with the given email.
+func User(t testing.TB, db *gorm.DB, email string) *models.User {
+	t.Helper()
+	user := models.User{FirstName: "Test", LastName: "User", Email: email, Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// Product creates a published product of ownerID.
+func Product(t testing.TB, db *gorm.DB, ownerID uint, name string, price float64, stock int) *models.Product {
+	t.Helper()
+	product := models.Product{Name: name, Price: price, Stock: stock, OwnerID: ownerID, Status: "published"}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &product
+}